@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+// Exit codes. Scripts may rely on these; they are listed in the README.
+const (
+	exitIntegrity   = 1 // a pack or input tree failed verification
+	exitUsage       = 2 // bad command, flags or arguments
+	exitIO          = 3 // a file or directory could not be read or written
+	exitFailure     = 4 // anything else
+	exitPolicy      = 5 // input rejected by a policy, e.g. --symlinks=error
+	exitUnstable    = 6 // a file kept changing while it was hashed
+	exitInterrupted = 130
+)
+
+// exitCode maps an error to its exit code. Integrity is checked before I/O
+// because a missing input file is an integrity failure that wraps ENOENT.
+func exitCode(err error) int {
+	var missing *auditpack.MissingChecksumError
+	switch {
+	case errors.Is(err, auditpack.ErrUsage):
+		return exitUsage
+	case errors.Is(err, auditpack.ErrIntegrity):
+		return exitIntegrity
+	case errors.As(err, &missing), auditpack.IsIOError(err):
+		return exitIO
+	case errors.Is(err, auditpack.ErrPolicy):
+		return exitPolicy
+	case errors.Is(err, auditpack.ErrUnstable):
+		return exitUnstable
+	}
+	return exitFailure
+}
+
+// fail prints err to stderr after prefix and exits with its exit code.
+func fail(prefix string, err error) {
+	fmt.Fprintln(os.Stderr, prefix, err)
+	os.Exit(exitCode(err))
+}
+
+// usageFail prints a usage error to stderr and exits with exitUsage.
+func usageFail(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(exitUsage)
+}
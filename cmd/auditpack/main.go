@@ -2,20 +2,52 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/pathfilter"
 )
 
 var version = "dev"
 
+// stringList is a repeatable string flag (e.g. --exclude a --exclude b).
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// retryFlags registers --retries and --retry-delay on fs and returns a
+// function that reads the policy back after parsing.
+func retryFlags(fs *flag.FlagSet) func() auditpack.RetryPolicy {
+	def := auditpack.DefaultRetryPolicy
+	retries := fs.Int("retries", def.Retries, "times to re-read a file that changed while it was being hashed before reporting it unstable")
+	delay := fs.Duration("retry-delay", def.Delay, "wait before the first re-read of a changing file (doubled for each further one)")
+	return func() auditpack.RetryPolicy {
+		if *retries < 0 || *delay < 0 {
+			usageFail(errors.New("--retries and --retry-delay must not be negative"))
+		}
+		return auditpack.RetryPolicy{Retries: *retries, Delay: *delay}
+	}
+}
+
 func main() {
 	if len(os.Args) < 2 {
-		usage()
-		os.Exit(2)
+		usage(os.Stderr)
+		os.Exit(exitUsage)
 	}
 
 	switch os.Args[1] {
@@ -25,32 +57,53 @@ func main() {
 		runCmd(os.Args[2:])
 	case "verify":
 		verifyCmd(os.Args[2:])
+	case "keygen":
+		keygenCmd(os.Args[2:])
+	case "sign":
+		signCmd(os.Args[2:])
 	case "self-check", "selfcheck", "check":
 		selfCheckCmd(os.Args[2:])
 	case "version", "--version", "-v":
 		versionCmd()
 	case "help", "-h", "--help":
-		usage()
+		usage(os.Stdout)
 	default:
-		fmt.Println("Unknown command:", os.Args[1])
-		fmt.Println()
-		usage()
-		os.Exit(2)
+		fmt.Fprintln(os.Stderr, "Unknown command:", os.Args[1])
+		fmt.Fprintln(os.Stderr)
+		usage(os.Stderr)
+		os.Exit(exitUsage)
 	}
 }
 
-func usage() {
-	fmt.Println("proof-first-auditpack")
-	fmt.Println()
-	fmt.Println("Usage:")
-	fmt.Println("  auditpack demo   --out <dir>")
-	fmt.Println("  auditpack run    --in  <dir> --out <dir> [--label <string>]")
-	fmt.Println("  auditpack verify --pack <dir> [--in <dir>] [--strict]")
-	fmt.Println("  auditpack self-check [--keep] [--strict]")
-	fmt.Println("  auditpack version")
-	fmt.Println()
-	fmt.Println("v0: writes manifest.json + run_meta.json + manifest.sha256 (deterministic)")
-	fmt.Println("v0.2+: verify checks pack integrity and (optionally) input tree integrity")
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "proof-first-auditpack")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  auditpack demo   --out <dir>")
+	fmt.Fprintln(w, "  auditpack run    --in  <dir> --out <dir> [--label <string>] [--jobs N]")
+	fmt.Fprintln(w, "                   [--include <glob>]... [--exclude <glob>]...")
+	fmt.Fprintln(w, "                   [--symlinks skip|record|follow|error] [--on-special skip|record|error]")
+	fmt.Fprintln(w, "                   [--on-error fail|record] [--record-dirs] [--capture mode,mtime,uid,gid]")
+	fmt.Fprintln(w, "                   [--digest sha256,sha512,sha3-256]")
+	fmt.Fprintln(w, "                   [--stat-cache] [--baseline <old-pack> [--paranoid]] [--progress]")
+	fmt.Fprintln(w, "                   [--retries N] [--retry-delay <duration>] [--attest]")
+	fmt.Fprintln(w, "  auditpack verify --pack <dir> [--strict-pack] [--in <dir> | --in-archive <file>] [--strict] [--jobs N]")
+	fmt.Fprintln(w, "                   [--ignore-attrs mode,mtime,uid,gid] [--progress]")
+	fmt.Fprintln(w, "                   [--report <file.json>] [--fail-fast] [--quick]")
+	fmt.Fprintln(w, "                   [--path <glob>]... [--paths-from <file>] [--retries N] [--retry-delay <duration>]")
+	fmt.Fprintln(w, "                   [--pubkey <key.pub>] [--allowed-signers <file> --identity <principal>]")
+	fmt.Fprintln(w, "                   [--trusted-keys <keys.json> [--require N]] [--attestation <statement.json>]")
+	fmt.Fprintln(w, "                   [--dsse <envelope.json> --dsse-key <key.pub>...]")
+	fmt.Fprintln(w, "  auditpack keygen --out <prefix> [--alg ed25519|ecdsa-p256]")
+	fmt.Fprintln(w, "  auditpack sign   --pack <dir> (--key <key> [--add] | --ssh-key <~/.ssh/id_ed25519>)")
+	fmt.Fprintln(w, "  auditpack sign   --pack <dir> --dsse manifest|attestation --key <key>...")
+	fmt.Fprintln(w, "  auditpack self-check [--keep] [--strict]")
+	fmt.Fprintln(w, "  auditpack version")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "v0: writes manifest.json + run_meta.json + manifest.sha256 (deterministic)")
+	fmt.Fprintln(w, "v0.2+: verify checks pack integrity and (optionally) input tree integrity")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit status: 0 ok, 1 integrity failure, 2 usage error, 3 I/O error, 4 other failure, 5 rejected by policy, 6 file unstable, 130 interrupted")
 }
 
 func demoCmd(args []string) {
@@ -77,33 +130,28 @@ func demoCmd(args []string) {
 	opts.InputLabel = filepath.ToSlash(filepath.Join("fixtures", "input", caseName))
 
 	if err := auditpack.Build(inDir, packDir, opts); err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+		fail("Error:", err)
 	}
 
 	if err := auditpack.VerifyPack(packDir); err != nil {
-		fmt.Println("VERIFY FAIL:", err)
-		os.Exit(1)
+		fail("VERIFY FAIL:", err)
 	}
 	if err := auditpack.VerifyInput(inDir, packDir, true); err != nil {
-		fmt.Println("VERIFY FAIL:", err)
-		os.Exit(1)
+		fail("VERIFY FAIL:", err)
 	}
 
 	for _, name := range []string{"manifest.json", "manifest.sha256", "run_meta.json"} {
 		expB, err := os.ReadFile(filepath.Join(expDir, name))
 		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
+			fail("Error:", err)
 		}
 		gotB, err := os.ReadFile(filepath.Join(packDir, name))
 		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
+			fail("Error:", err)
 		}
 		if !bytes.Equal(gotB, expB) {
-			fmt.Printf("MISMATCH: %s (%s)\n", caseName, name)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "MISMATCH: %s (%s)\n", caseName, name)
+			os.Exit(exitIntegrity)
 		}
 	}
 
@@ -124,17 +172,14 @@ func demoQuick(outDir string) {
 	opts.InputLabel = "demo_input"
 
 	if err := auditpack.Build(inDir, outDir, opts); err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+		fail("Error:", err)
 	}
 
 	if err := auditpack.VerifyPack(outDir); err != nil {
-		fmt.Println("VERIFY FAIL:", err)
-		os.Exit(1)
+		fail("VERIFY FAIL:", err)
 	}
 	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
-		fmt.Println("VERIFY FAIL:", err)
-		os.Exit(1)
+		fail("VERIFY FAIL:", err)
 	}
 
 	fmt.Printf("OK: quick demo complete (pack=%s)\n", outDir)
@@ -145,13 +190,29 @@ func runCmd(args []string) {
 	inDir := fs.String("in", "", "input directory")
 	outDir := fs.String("out", "./out", "output directory")
 	label := fs.String("label", "", "optional: stable label recorded in manifest/meta (useful when --in is absolute)")
+	jobs := fs.Int("jobs", 0, "number of files to hash concurrently (0 = one per CPU); output is identical for any value")
+	var include, exclude stringList
+	fs.Var(&include, "include", "repeatable: only pack files matching this glob (supports **)")
+	fs.Var(&exclude, "exclude", "repeatable: skip paths matching this glob (supports **; same syntax as .auditpackignore)")
+	symlinks := fs.String("symlinks", "skip", "symlink policy: skip|record|follow|error")
+	digest := fs.String("digest", "sha256", "comma-separated digest algorithms computed per file: sha256,sha512,sha3-256")
+	baseline := fs.String("baseline", "", "optional: previous pack (built with --stat-cache) whose digests are reused for unchanged files; without a stat cache every file is re-hashed")
+	paranoid := fs.Bool("paranoid", false, "with --baseline: ignore the baseline and re-hash every file")
+	statCache := fs.Bool("stat-cache", false, "if set: write stat_cache.json so this pack can be used as a --baseline later")
+	capture := fs.String("capture", "", "optional: comma-separated metadata to record per entry: mode,mtime,uid,gid")
+	recordDirs := fs.Bool("record-dirs", false, "if set: record every directory (including empty ones) as a manifest entry")
+	onSpecial := fs.String("on-special", "skip", "sockets/FIFOs/devices: skip|record (list under \"skipped\" in manifest.json)|error")
+	onError := fs.String("on-error", "fail", "unreadable input paths: fail|record (list under \"errors\" in manifest.json and mark the pack incomplete)")
+	progress := fs.Bool("progress", false, "if set: print files, bytes, throughput and ETA to stderr")
+	attest := fs.Bool("attest", false, "if set: write attestation.intoto.json, an in-toto Statement (SLSA provenance) whose subjects are the manifest entries")
+	retry := retryFlags(fs)
 	_ = fs.Parse(args)
 
 	if *inDir == "" {
-		fmt.Println("Error: --in is required")
-		fmt.Println()
-		usage()
-		os.Exit(2)
+		fmt.Fprintln(os.Stderr, "Error: --in is required")
+		fmt.Fprintln(os.Stderr)
+		usage(os.Stderr)
+		os.Exit(exitUsage)
 	}
 
 	opts := auditpack.DefaultOptions()
@@ -162,13 +223,73 @@ func runCmd(args []string) {
 	} else {
 		opts.InputLabel = *inDir
 	}
+	opts.Jobs = *jobs
+	opts.Include = include
+	opts.Exclude = exclude
+	policy, err := auditpack.ParseSymlinkPolicy(*symlinks)
+	if err != nil {
+		usageFail(err)
+	}
+	opts.Symlinks = policy
+	special, err := auditpack.ParseSpecialPolicy(*onSpecial)
+	if err != nil {
+		usageFail(err)
+	}
+	opts.OnSpecial = special
+	errPolicy, err := auditpack.ParseErrorPolicy(*onError)
+	if err != nil {
+		usageFail(err)
+	}
+	opts.OnError = errPolicy
+	opts.RecordDirs = *recordDirs
+	attrs, err := auditpack.ParseAttrs(*capture)
+	if err != nil {
+		usageFail(err)
+	}
+	opts.Capture = attrs
+	algs, err := hashing.ParseNames(*digest)
+	if err != nil {
+		usageFail(err)
+	}
+	opts.Digests = algs
+	opts.Baseline = *baseline
+	opts.Paranoid = *paranoid
+	opts.StatCache = *statCache
+	opts.Retry = retry()
+	opts.Attest = *attest
+	opts.Warn = func(msg string) { fmt.Fprintln(os.Stderr, "warning:", msg) }
+	if *progress {
+		opts.Progress = newProgressPrinter(os.Stderr)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
 
-	if err := auditpack.Build(*inDir, *outDir, opts); err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+	if err := auditpack.BuildContext(ctx, *inDir, *outDir, opts); err != nil {
+		if ctx.Err() != nil {
+			interrupted(*outDir)
+		}
+		fail("Error:", err)
 	}
 
 	fmt.Printf("Run complete. Wrote audit pack to %s\n", *outDir)
+	warnIncomplete(*outDir)
+}
+
+// verifyAttestation checks an in-toto Statement for verify --attestation.
+func verifyAttestation(ctx context.Context, pack, path string) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		fail("Error: read attestation:", err)
+	}
+	n, err := auditpack.VerifyAttestation(ctx, pack, b)
+	if err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("VERIFY FAIL:", err)
+	}
+	fmt.Printf("OK: attestation subjects match manifest.json (%d subjects)\n", n)
 }
 
 func verifyCmd(args []string) {
@@ -176,18 +297,42 @@ func verifyCmd(args []string) {
 	packDir := fs.String("pack", "./out", "audit pack directory")
 	outDir := fs.String("out", "", "deprecated alias for --pack")
 	inDir := fs.String("in", "", "optional: original input directory to verify against manifest.json")
+	pubkey := fs.String("pubkey", "", "optional: Ed25519 public key (PEM); the pack must carry a valid manifest.sha256.sig by it")
+	allowedSigners := fs.String("allowed-signers", "", "optional: OpenSSH allowed_signers file; the pack must carry a valid manifest.sha256.sshsig by --identity")
+	identity := fs.String("identity", "", "with --allowed-signers: signer principal to require, e.g. alice@example.com")
+	trustedKeys := fs.String("trusted-keys", "", "optional: JSON file of trusted Ed25519 keys; requires --require valid sign-offs in signatures/")
+	attestation := fs.String("attestation", "", "optional: in-toto Statement (e.g. <pack>/attestation.intoto.json) whose subjects must match manifest.json exactly")
+	dsse := fs.String("dsse", "", "optional: DSSE envelope over manifest.sha256 or an in-toto Statement; its payload must match the pack")
+	var dsseKeys stringList
+	fs.Var(&dsseKeys, "dsse-key", "repeatable (with --dsse): Ed25519 or ECDSA P-256 public key (PEM) that must have signed the envelope")
+	require := fs.Int("require", 1, "with --trusted-keys: number of distinct trusted keys that must have signed manifest.sha256")
+	inArchive := fs.String("in-archive", "", "optional: tar, tar.gz or zip archive of the input tree to verify against manifest.json, without extracting it")
 	strict := fs.Bool("strict", false, "if set: fail on extra input files not listed in manifest.json")
+	strictPack := fs.Bool("strict-pack", false, "if set: the pack directory must hold exactly the expected files, fully covered by its checksum files, with no leftover *.tmp-* files")
+	jobs := fs.Int("jobs", 0, "number of input files to hash concurrently (0 = one per CPU)")
+	ignoreAttrs := fs.String("ignore-attrs", "", "optional: captured metadata not to enforce, e.g. mtime or mtime,uid,gid")
+	progress := fs.Bool("progress", false, "if set: print input verification progress (throughput, ETA) to stderr")
+	reportPath := fs.String("report", "", "optional (with --in): write every problem found, with expected and actual values, to this JSON file")
+	failFast := fs.Bool("fail-fast", false, "with --in: stop at the first problem instead of listing all of them")
+	var paths stringList
+	fs.Var(&paths, "path", "repeatable (with --in): only check manifest entries matching this glob (supports **); others are not reported missing")
+	pathsFrom := fs.String("paths-from", "", "optional (with --in): file of --path globs, one per line (# comments allowed)")
+	retry := retryFlags(fs)
+	quick := fs.Bool("quick", false, "with --in: compare sizes (and captured mtimes) without reading files; re-hash only files that differ (NOT cryptographic verification)")
 	_ = fs.Parse(args)
 
 	// Back-compat: allow --out as alias for --pack.
 	packExplicit := false
 	outExplicit := false
+	requireExplicit := false
 	fs.Visit(func(f *flag.Flag) {
 		switch f.Name {
 		case "pack":
 			packExplicit = true
 		case "out":
 			outExplicit = true
+		case "require":
+			requireExplicit = true
 		}
 	})
 
@@ -196,22 +341,136 @@ func verifyCmd(args []string) {
 		pack = *outDir
 	}
 	if outExplicit && packExplicit && *outDir != "" && *outDir != *packDir {
-		fmt.Println("Error: --pack and --out were both provided with different values")
-		os.Exit(2)
+		usageFail(errors.New("--pack and --out were both provided with different values"))
+	}
+	if *inDir != "" && *inArchive != "" {
+		usageFail(errors.New("--in and --in-archive cannot be used together"))
+	}
+	if (*allowedSigners == "") != (*identity == "") {
+		usageFail(errors.New("--allowed-signers and --identity must be used together"))
+	}
+	if (*dsse == "") != (len(dsseKeys) == 0) {
+		usageFail(errors.New("--dsse and --dsse-key must be used together"))
+	}
+	if requireExplicit && *trustedKeys == "" {
+		usageFail(errors.New("--require requires --trusted-keys"))
+	}
+	checkInput := *inDir != "" || *inArchive != ""
+	if *reportPath != "" && !checkInput {
+		usageFail(errors.New("--report requires --in or --in-archive"))
+	}
+	if *quick && *inDir == "" {
+		usageFail(errors.New("--quick requires --in"))
+	}
+	if (len(paths) > 0 || *pathsFrom != "") && !checkInput {
+		usageFail(errors.New("--path and --paths-from require --in or --in-archive"))
+	}
+	if *pathsFrom != "" {
+		data, err := os.ReadFile(*pathsFrom)
+		if err != nil {
+			fail("Error: read --paths-from:", err)
+		}
+		lines := pathfilter.ParseIgnoreFile(data)
+		if len(lines) == 0 {
+			usageFail(fmt.Errorf("--paths-from %s lists no paths", *pathsFrom))
+		}
+		paths = append(paths, lines...)
 	}
 
-	if err := auditpack.VerifyPack(pack); err != nil {
-		fmt.Println("VERIFY FAIL:", err)
-		os.Exit(1)
+	ctx, stop := interruptContext()
+	defer stop()
+
+	verifyPack := auditpack.VerifyPackContext
+	if *strictPack {
+		verifyPack = auditpack.VerifyPackStrict
+	}
+	if err := verifyPack(ctx, pack); err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("VERIFY FAIL:", err)
+	}
+	fmt.Println("OK: pack integrity (pack checksums + manifest.json invariants)")
+	if *strictPack {
+		fmt.Println("OK: pack directory holds exactly the expected files")
+	}
+	if *pubkey != "" {
+		verifySignature(ctx, pack, *pubkey)
+	}
+	if *allowedSigners != "" {
+		verifySSHSignature(ctx, pack, *allowedSigners, *identity)
 	}
-	fmt.Println("OK: pack integrity (manifest.sha256 + manifest.json invariants)")
+	if *trustedKeys != "" {
+		verifySignOffs(ctx, pack, *trustedKeys, *require)
+	}
+	if *attestation != "" {
+		verifyAttestation(ctx, pack, *attestation)
+	}
+	if *dsse != "" {
+		verifyDSSE(ctx, pack, *dsse, dsseKeys)
+	}
+	warnIncomplete(pack)
 
-	if *inDir != "" {
-		if err := auditpack.VerifyInput(*inDir, pack, *strict); err != nil {
-			fmt.Println("VERIFY FAIL:", err)
-			os.Exit(1)
+	if checkInput {
+		ignore, err := auditpack.ParseAttrs(*ignoreAttrs)
+		if err != nil {
+			usageFail(err)
+		}
+		vopts := auditpack.DefaultVerifyOptions()
+		vopts.Strict = *strict
+		vopts.Jobs = *jobs
+		vopts.IgnoreAttrs = ignore
+		vopts.FailFast = *failFast
+		vopts.Quick = *quick
+		vopts.Paths = paths
+		vopts.Retry = retry()
+		if *progress {
+			vopts.Progress = newProgressPrinter(os.Stderr)
+		}
+		var report *auditpack.VerifyReport
+		if *inArchive != "" {
+			report, err = auditpack.VerifyArchiveReport(ctx, *inArchive, pack, vopts)
+		} else {
+			report, err = auditpack.VerifyInputReport(ctx, *inDir, pack, vopts)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				interrupted("")
+			}
+			fail("VERIFY FAIL:", err)
+		}
+		if *reportPath != "" {
+			if err := report.WriteJSON(*reportPath); err != nil {
+				fail("Error: write report:", err)
+			}
+		}
+		if len(report.Paths) > 0 {
+			fmt.Printf("Coverage: checked %d of %d manifest entries (%d of %d bytes) selected by --path; the rest were not checked\n",
+				report.Selected, report.Entries, report.SelectedBytes, report.TotalBytes)
+		}
+		if !report.OK {
+			for _, pr := range report.Problems {
+				fmt.Fprintln(os.Stderr, "VERIFY FAIL:", pr.Message)
+			}
+			if len(report.Problems) > 1 {
+				fmt.Fprintf(os.Stderr, "%d problems found in input tree\n", len(report.Problems))
+			}
+			os.Exit(exitIntegrity)
+		}
+		if *quick {
+			fmt.Printf("OK (QUICK CHECK): input tree sizes and captured mtimes match manifest.json; %d of %d entries re-hashed\n",
+				report.Rehashed, report.Entries)
+			fmt.Println("NOTE: a quick check is NOT cryptographic verification; run verify --in without --quick to re-hash every file")
+			return
+		}
+		switch {
+		case len(report.Paths) > 0:
+			fmt.Println("OK: selected input paths match manifest.json")
+		case *inArchive != "":
+			fmt.Println("OK: input archive matches manifest.json")
+		default:
+			fmt.Println("OK: input tree matches manifest.json")
 		}
-		fmt.Println("OK: input tree matches manifest.json")
 	}
 }
 
@@ -226,8 +485,7 @@ func selfCheckCmd(args []string) {
 		Keep:   *keep,
 	})
 	if err != nil {
-		fmt.Println("SELF-CHECK FAIL:", err)
-		os.Exit(1)
+		fail("SELF-CHECK FAIL:", err)
 	}
 
 	if *keep {
@@ -238,6 +496,53 @@ func selfCheckCmd(args []string) {
 	}
 }
 
+// maxListedErrors bounds how many unreadable paths warnIncomplete prints.
+const maxListedErrors = 20
+
+// warnIncomplete prints a warning when the pack was built with
+// --on-error=record and some input paths could not be read, since a passing
+// verify then does not vouch for the whole input tree.
+func warnIncomplete(pack string) {
+	m, err := auditpack.VerifyManifestSummary(filepath.Join(pack, "manifest.json"))
+	if err != nil || len(m.Errors) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: pack is incomplete: %d input path(s) could not be read at build time and are NOT covered:\n", len(m.Errors))
+	for i, ee := range m.Errors {
+		if i == maxListedErrors {
+			fmt.Fprintf(os.Stderr, "  ... and %d more (see \"errors\" in manifest.json)\n", len(m.Errors)-i)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %s (%s)\n", ee.Path, ee.Class)
+	}
+}
+
+// interruptContext returns a context that is cancelled on Ctrl-C or SIGTERM,
+// so long runs can stop cleanly instead of being killed mid-write. Once it is
+// cancelled the default signal handling is restored, so a second Ctrl-C
+// kills a process stuck in a slow read or write.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// interrupted removes temp files an interrupted build may have left in outDir
+// (if any) and exits with the conventional status for SIGINT.
+func interrupted(outDir string) {
+	fmt.Fprintln(os.Stderr)
+	if outDir != "" {
+		if err := auditpack.RemoveTempFiles(outDir); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: cleaning temp files:", err)
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Interrupted.")
+	os.Exit(exitInterrupted)
+}
+
 func versionCmd() {
 	fmt.Printf("proof-first-auditpack %s\n", version)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+// progressPrinter renders auditpack.Progress as a single, periodically
+// rewritten status line (files, bytes, throughput, ETA).
+type progressPrinter struct {
+	w     io.Writer
+	start time.Time
+	last  time.Time
+}
+
+func newProgressPrinter(w io.Writer) auditpack.ProgressFunc {
+	pp := &progressPrinter{w: w, start: time.Now()}
+	return pp.update
+}
+
+func (pp *progressPrinter) update(p auditpack.Progress) {
+	now := time.Now()
+	final := p.FilesTotal > 0 && p.FilesDone == p.FilesTotal
+	if !final && now.Sub(pp.last) < 250*time.Millisecond {
+		return
+	}
+	pp.last = now
+
+	rate := 0.0
+	if elapsed := now.Sub(pp.start).Seconds(); elapsed > 0 {
+		rate = float64(p.BytesDone) / elapsed
+	}
+	eta := "--"
+	if final {
+		eta = "0s"
+	} else if rate > 0 && p.BytesTotal > p.BytesDone {
+		eta = (time.Duration(float64(p.BytesTotal-p.BytesDone)/rate) * time.Second).Round(time.Second).String()
+	}
+
+	fmt.Fprintf(pp.w, "\r%s: %d/%d files, %s/%s, %s/s, ETA %s   ",
+		p.Phase, p.FilesDone, p.FilesTotal,
+		humanBytes(float64(p.BytesDone)), humanBytes(float64(p.BytesTotal)),
+		humanBytes(rate), eta)
+	if final {
+		fmt.Fprintln(pp.w)
+	}
+}
+
+func humanBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := -1
+	for n >= unit && i < len(suffixes)-1 {
+		n /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, suffixes[i])
+}
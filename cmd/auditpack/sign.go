@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+func keygenCmd(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "", "path prefix: writes <prefix>.key (private, mode 0600) and <prefix>.pub")
+	alg := fs.String("alg", signing.AlgEd25519, "key algorithm: ed25519|ecdsa-p256 (ecdsa-p256 keys can only sign DSSE envelopes)")
+	_ = fs.Parse(args)
+
+	if *out == "" {
+		usageFail(errors.New("--out is required"))
+	}
+	keyPath, pubPath := *out+".key", *out+".pub"
+	for _, p := range []string{keyPath, pubPath} {
+		if _, err := os.Lstat(p); err == nil {
+			usageFail(fmt.Errorf("refusing to overwrite %s", p))
+		}
+	}
+
+	priv, err := signing.GenerateKey(*alg)
+	if err != nil {
+		usageFail(err)
+	}
+	pub := priv.Public()
+	keyPEM, err := signing.MarshalPrivateKey(priv)
+	if err != nil {
+		fail("Error: encode private key:", err)
+	}
+	pubPEM, err := signing.MarshalPublicKey(pub)
+	if err != nil {
+		fail("Error: encode public key:", err)
+	}
+	if err := writeNewFile(keyPath, keyPEM, 0o600); err != nil {
+		fail("Error: write private key:", err)
+	}
+	if err := writeNewFile(pubPath, pubPEM, 0o644); err != nil {
+		// A .key without its .pub would make the next keygen refuse.
+		_ = os.Remove(keyPath)
+		fail("Error: write public key:", err)
+	}
+	id, _ := signing.KeyID(pub)
+	fmt.Printf("OK: wrote %s (private: keep it secret) and %s\n", keyPath, pubPath)
+	fmt.Printf("key id: %s\n", id)
+}
+
+func signCmd(args []string) {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	pack := fs.String("pack", "./out", "audit pack directory")
+	var keys stringList
+	fs.Var(&keys, "key", "private key (PEM, from auditpack keygen); Ed25519, or ECDSA P-256 with --dsse; repeatable with --dsse")
+	dsse := fs.String("dsse", "", "manifest|attestation: add signatures to a DSSE envelope over manifest.sha256 or attestation.intoto.json")
+	add := fs.Bool("add", false, "with --key: add a sign-off to signatures/ next to any existing ones, instead of writing manifest.sha256.sig (which is never replaced)")
+	sshKey := fs.String("ssh-key", "", "OpenSSH Ed25519 key: writes an SSHSIG signature (manifest.sha256.sshsig); a passphrase-protected key or a .pub file signs through ssh-agent")
+	_ = fs.Parse(args)
+
+	switch {
+	case len(keys) > 0 && *sshKey != "":
+		usageFail(errors.New("--key and --ssh-key cannot be used together"))
+	case len(keys) == 0 && *sshKey == "":
+		usageFail(errors.New("--key or --ssh-key is required"))
+	case *dsse != "" && (*add || *sshKey != ""):
+		usageFail(errors.New("--dsse cannot be combined with --add or --ssh-key"))
+	case *add && len(keys) == 0:
+		usageFail(errors.New("--add requires --key"))
+	case len(keys) > 1 && *dsse == "":
+		usageFail(errors.New("--key can only be repeated with --dsse"))
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	if *sshKey != "" {
+		signSSH(ctx, *pack, *sshKey)
+		return
+	}
+	if *dsse != "" {
+		signDSSE(ctx, *pack, *dsse, keys)
+		return
+	}
+	key := readPrivateKey(keys[0])
+	if *add {
+		addSignOff(ctx, *pack, key)
+		return
+	}
+	if err := auditpack.SignPack(ctx, *pack, key); err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("SIGN FAIL:", err)
+	}
+	id, _ := signing.KeyID(key.Public())
+	fmt.Printf("OK: wrote %s (key id %s)\n", auditpack.SignatureFile, id)
+}
+
+// verifySignature checks the pack signature for verify --pubkey.
+func verifySignature(ctx context.Context, pack, pubPath string) {
+	pub := readPublicKey(pubPath)
+	if err := auditpack.VerifyPackSignature(ctx, pack, pub); err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("VERIFY FAIL:", err)
+	}
+	id, _ := signing.KeyID(pub)
+	fmt.Printf("OK: %s is a valid signature by key %s\n", auditpack.SignatureFile, id)
+}
+
+func signDSSE(ctx context.Context, pack, what string, keyPaths []string) {
+	signers := make([]signing.Signer, 0, len(keyPaths))
+	for _, p := range keyPaths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			fail("Error: read key:", err)
+		}
+		key, err := signing.ParsePrivateKey(b)
+		if err != nil {
+			usageFail(fmt.Errorf("%s: %w", p, err))
+		}
+		s, err := signing.NewSigner(key)
+		if err != nil {
+			usageFail(fmt.Errorf("%s: %w", p, err))
+		}
+		signers = append(signers, s)
+	}
+	name, err := auditpack.SignPackDSSE(ctx, pack, what, signers)
+	if err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("SIGN FAIL:", err)
+	}
+	for _, s := range signers {
+		fmt.Printf("OK: signed %s (key id %s)\n", name, s.KeyID())
+	}
+}
+
+// verifyDSSE checks a DSSE envelope for verify --dsse: every --dsse-key must
+// have signed it, and its payload must belong to the pack.
+func verifyDSSE(ctx context.Context, pack, envPath string, pubPaths []string) {
+	b, err := os.ReadFile(envPath)
+	if err != nil {
+		fail("Error: read DSSE envelope:", err)
+	}
+	verifiers := make([]signing.Verifier, 0, len(pubPaths))
+	for _, p := range pubPaths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			fail("Error: read public key:", err)
+		}
+		pub, err := signing.ParsePublicKey(data)
+		if err != nil {
+			usageFail(fmt.Errorf("%s: %w", p, err))
+		}
+		v, err := signing.NewVerifier(pub)
+		if err != nil {
+			usageFail(fmt.Errorf("%s: %w", p, err))
+		}
+		verifiers = append(verifiers, v)
+	}
+	rep, err := auditpack.VerifyPackDSSE(ctx, pack, b, verifiers)
+	if rep != nil {
+		fmt.Printf("DSSE envelope (%s), signatures: %d\n", rep.PayloadType, len(rep.Signatures))
+		for _, c := range rep.Signatures {
+			status := "valid"
+			switch {
+			case !c.Known:
+				status = "not checked (key not given)"
+			case !c.Valid:
+				status = "INVALID: " + c.Err
+			case c.VerifiedBy != c.KeyID:
+				status = "valid (by key " + c.VerifiedBy + ")"
+			}
+			keyID := c.KeyID
+			if keyID == "" {
+				keyID = "-"
+			}
+			fmt.Printf("  key %s: %s\n", keyID, status)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("VERIFY FAIL:", err)
+	}
+	fmt.Printf("OK: %s is signed by every given key and matches the pack\n", envPath)
+}
+
+func addSignOff(ctx context.Context, pack string, key ed25519.PrivateKey) {
+	rel, err := auditpack.AddSignOff(ctx, pack, key)
+	if err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("SIGN FAIL:", err)
+	}
+	id, _ := signing.KeyID(key.Public())
+	fmt.Printf("OK: added %s (key id %s)\n", rel, id)
+}
+
+func signSSH(ctx context.Context, pack, keyPath string) {
+	signer, err := signing.LoadSSHSigner(keyPath)
+	if err != nil {
+		usageFail(err)
+	}
+	if err := auditpack.SignPackSSH(ctx, pack, signer); err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("SIGN FAIL:", err)
+	}
+	fmt.Printf("OK: wrote %s (key %s, namespace %q)\n", auditpack.SSHSignatureFile,
+		signing.SSHFingerprint(signer.PublicKey()), auditpack.SSHNamespace)
+}
+
+// verifySSHSignature checks the SSHSIG pack signature for verify
+// --allowed-signers.
+func verifySSHSignature(ctx context.Context, pack, allowedPath, identity string) {
+	b, err := os.ReadFile(allowedPath)
+	if err != nil {
+		fail("Error: read allowed signers:", err)
+	}
+	signers, err := signing.ParseAllowedSigners(b)
+	if err != nil {
+		usageFail(fmt.Errorf("%s: %w", allowedPath, err))
+	}
+	fp, err := auditpack.VerifyPackSSH(ctx, pack, signers, identity)
+	if err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("VERIFY FAIL:", err)
+	}
+	fmt.Printf("OK: %s is a valid signature by %q with key %s\n", auditpack.SSHSignatureFile, identity, fp)
+}
+
+// verifySignOffs checks the signatures/ threshold for verify --trusted-keys
+// and lists every signer.
+func verifySignOffs(ctx context.Context, pack, trustedPath string, require int) {
+	b, err := os.ReadFile(trustedPath)
+	if err != nil {
+		fail("Error: read trusted keys:", err)
+	}
+	trusted, err := auditpack.ParseTrustedKeys(b)
+	if err != nil {
+		usageFail(fmt.Errorf("%s: %w", trustedPath, err))
+	}
+	rep, err := auditpack.VerifySignOffs(ctx, pack, trusted, require)
+	if rep != nil {
+		fmt.Printf("Sign-off: %d of %d required trusted keys signed manifest.sha256 (sha256 %s)\n",
+			rep.Satisfied, rep.Required, rep.ManifestSHA256)
+		for _, s := range rep.Signers {
+			name := s.Name
+			if !s.Trusted {
+				name = "(untrusted)"
+			}
+			keyID := s.KeyID
+			if keyID == "" {
+				keyID = "-"
+			}
+			status := "valid"
+			if !s.Valid {
+				status = "INVALID: " + s.Reason
+			}
+			fmt.Printf("  %s  %s  key %s: %s\n", s.File, name, keyID, status)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			interrupted("")
+		}
+		fail("VERIFY FAIL:", err)
+	}
+	fmt.Println("OK: sign-off threshold met")
+}
+
+func readPrivateKey(path string) ed25519.PrivateKey {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		fail("Error: read key:", err)
+	}
+	key, err := signing.ParseEd25519PrivateKey(b)
+	if err != nil {
+		usageFail(fmt.Errorf("%s: %w", path, err))
+	}
+	return key
+}
+
+func readPublicKey(path string) ed25519.PublicKey {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		fail("Error: read public key:", err)
+	}
+	pub, err := signing.ParseEd25519PublicKey(b)
+	if err != nil {
+		usageFail(fmt.Errorf("%s: %w", path, err))
+	}
+	return pub
+}
+
+// writeNewFile writes data to a file that must not exist yet. A file that
+// could not be written completely is removed again.
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
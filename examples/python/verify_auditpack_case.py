@@ -6,15 +6,29 @@ from __future__ import annotations
 import argparse
 import hashlib
 import json
+import os
 from pathlib import Path
 
 
-def sha256_file(p: Path) -> str:
-    h = hashlib.sha256()
+# auditpack digest names -> hashlib constructors.
+HASHLIB_NAMES = {"sha256": "sha256", "sha512": "sha512", "sha3-256": "sha3_256"}
+
+
+def hash_file(p: Path, algs: list[str]) -> dict[str, str]:
+    hs = {alg: hashlib.new(HASHLIB_NAMES[alg]) for alg in algs}
     with p.open("rb") as f:
         for chunk in iter(lambda: f.read(65536), b""):
-            h.update(chunk)
-    return h.hexdigest()
+            for h in hs.values():
+                h.update(chunk)
+    return {alg: h.hexdigest() for alg, h in hs.items()}
+
+
+def entry_digests(f: dict) -> dict[str, str]:
+    # sha256 lives in its own field; other algorithms are in "digests".
+    d = dict(f.get("digests") or {})
+    if f.get("sha256"):
+        d["sha256"] = f["sha256"]
+    return d
 
 
 def read_text_lf(p: Path) -> str:
@@ -36,19 +50,25 @@ def main() -> None:
 
     manifest_p = pack_dir / "manifest.json"
     meta_p = pack_dir / "run_meta.json"
-    sums_p = pack_dir / "manifest.sha256"
-
-    # 1) Verify manifest.sha256 matches actual hashes of pack artifacts.
-    expected: dict[str, str] = {}
-    for line in read_text_lf(sums_p).splitlines():
-        if not line.strip():
-            continue
-        h, name = line.split(None, 1)
-        expected[name.strip()] = h.strip()
-
-    for name, h in expected.items():
-        got = sha256_file(pack_dir / name)
-        assert got == h, f"sha256 mismatch for {name}"
+    meta = json.loads(read_text_lf(meta_p))
+    algs = meta.get("digests") or ["sha256"]
+    for alg in algs:
+        assert alg in HASHLIB_NAMES, f"unsupported digest algorithm: {alg}"
+
+    # 1) Verify each manifest.<alg> matches actual hashes of pack artifacts.
+    for alg in algs:
+        sums_p = pack_dir / f"manifest.{alg}"
+        expected: dict[str, str] = {}
+        for line in read_text_lf(sums_p).splitlines():
+            if not line.strip():
+                continue
+            h, name = line.split(None, 1)
+            expected[name.strip()] = h.strip()
+        for name in ("manifest.json", "run_meta.json"):
+            assert name in expected, f"{sums_p.name} does not cover {name}"
+        for name, h in expected.items():
+            got = hash_file(pack_dir / name, [alg])[alg]
+            assert got == h, f"{alg} mismatch for {name}"
 
     # 2) Verify manifest.json structure and stable ordering.
     manifest = json.loads(read_text_lf(manifest_p))
@@ -57,16 +77,45 @@ def main() -> None:
     assert paths == sorted(paths), "manifest files not sorted by path"
     assert len(paths) == len(set(paths)), "manifest paths must be unique"
 
-    # 3) Verify each manifest record matches the input directory.
+    # 3) Verify each manifest record matches the input directory. Entries
+    # without a "type" are regular files; "dir" and "symlink" entries come
+    # from --record-dirs and --symlinks record.
+    follow = meta.get("symlinks") == "follow"
+    counts = {"": 0, "dir": 0, "symlink": 0}
     for f in files:
+        typ = f.get("type", "")
+        assert typ in counts, f"unknown entry type {typ!r}: {f['path']}"
+        counts[typ] += 1
         p = in_dir / f["path"]
-        assert p.exists(), f"missing input file: {p}"
-        assert p.is_file(), f"not a file: {p}"
+        assert os.path.lexists(p), f"missing input path: {p}"
+        if typ == "dir":
+            assert p.is_dir() and not p.is_symlink(), f"not a directory: {p}"
+            continue
+        if typ == "symlink":
+            assert p.is_symlink(), f"not a symlink: {p}"
+            # The size and digests of a symlink entry describe its link text.
+            target = os.readlink(p).replace(os.sep, "/")
+            assert target == f["target"], f"symlink target mismatch: {p}"
+            data = target.encode("utf-8")
+            assert len(data) == f["size_bytes"], f"size mismatch: {p}"
+            for alg, want in entry_digests(f).items():
+                assert hashlib.new(HASHLIB_NAMES[alg], data).hexdigest() == want, f"{alg} mismatch: {p}"
+            continue
+        assert follow or not p.is_symlink(), f"not a regular file: {p}"
+        assert p.is_file(), f"not a regular file: {p}"
         assert p.stat().st_size == f["size_bytes"], f"size mismatch: {p}"
-        assert sha256_file(p) == f["sha256"], f"hash mismatch: {p}"
+        want = entry_digests(f)
+        assert want, f"no digest recorded: {f['path']}"
+        got = hash_file(p, sorted(want))
+        for alg in want:
+            assert got[alg] == want[alg], f"{alg} mismatch: {p}"
+
+    summary = manifest["summary"]
+    assert summary["file_count"] == counts[""], "summary file_count mismatch"
+    assert summary.get("dir_count", 0) == counts["dir"], "summary dir_count mismatch"
+    assert summary.get("symlink_count", 0) == counts["symlink"], "summary symlink_count mismatch"
 
     # 4) Verify run_meta.json summary matches computed totals.
-    meta = json.loads(read_text_lf(meta_p))
     assert meta["tool"] == "proof-first-auditpack"
 
     in_label = str(meta.get("input", ""))
@@ -79,3 +128,9 @@ def main() -> None:
         or in_label.endswith(in_dir.name)
     )
     assert ok, f"run_meta.json input label mismatch: {in_label}"
+
+    print(f"OK: {pack_dir} matches {in_dir} ({', '.join(algs)})")
+
+
+if __name__ == "__main__":
+    main()
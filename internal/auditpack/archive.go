@@ -0,0 +1,446 @@
+package auditpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// maxArchiveLinkTarget bounds the contents of a zip symlink member.
+const maxArchiveLinkTarget = 64 << 10
+
+// maxArchiveLinkHops bounds symlink chains resolved inside an archive.
+const maxArchiveLinkHops = 40
+
+// archiveHeader is one archive member, whatever the archive format.
+type archiveHeader struct {
+	name     string
+	kind     string // a manifest type or a specialKind
+	linkname string // symlink target
+	hardlink string // for a tar hard link, the member it links to
+}
+
+// archiveMember is what VerifyArchiveReport learned about one member.
+type archiveMember struct {
+	kind    string
+	target  string
+	size    int64
+	digests hashing.Digests // set when the contents were hashed
+	implied bool            // a directory only implied by the names of other members
+}
+
+// VerifyArchiveReport is VerifyInputReport for an input tree packed as a tar,
+// tar.gz or zip archive (told apart by content, not by name). Members are
+// read once, in archive order, without extracting anything: the contents of
+// selected regular files are hashed as they stream past and compared with
+// manifest.json, symlink members are compared by target, and strict mode
+// reports members the manifest does not list.
+//
+// Member names are taken relative to the archive root (a leading "./" is
+// dropped). An absolute name, a ".." component, a backslash, a name given
+// twice, or a member reached through a symlink member is an unsafe_path
+// problem and the member is not used; these problems come first in the
+// report, in archive order. Captured attributes (mode, mtime, uid, gid) are
+// not checked, because archive formats store them with different precision
+// and ownership semantics; VerifyOptions.Quick, Jobs and Retry do not apply.
+func VerifyArchiveReport(ctx context.Context, archivePath, outDir string, opts VerifyOptions) (_ *VerifyReport, err error) {
+	defer func() { err = asIntegrity(err) }()
+	if opts.Quick {
+		return nil, usageErrorf("a quick check cannot be used with an archive: its members are read anyway")
+	}
+	c, err := prepareInputCheck(outDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	rep := c.rep
+	rep.Archive = archivePath
+
+	hash := func(rel string) bool {
+		fe, ok := c.expected[rel]
+		return ok && fe.Type == manifest.TypeFile && c.sel.selects(rel)
+	}
+	prog := newTracker(opts.Progress, "verify", len(c.sorted), c.checkBytes)
+	members := make(map[string]*archiveMember, len(c.expected))
+	var unsafe []*Problem
+	err = walkArchive(ctx, archivePath, func(h archiveHeader, r io.Reader) error {
+		rel, err := archiveRelPath(h.name)
+		if err != nil {
+			unsafe = append(unsafe, newProblem(h.name, ProblemUnsafePath, "", "", "",
+				fmt.Errorf("archive member %q rejected: %w", h.name, err)))
+			return nil
+		}
+		if rel == "." {
+			return nil
+		}
+		if prev, ok := members[rel]; ok && !(prev.implied || prev.kind == manifest.TypeDir && h.kind == manifest.TypeDir) {
+			unsafe = append(unsafe, newProblem(rel, ProblemUnsafePath, "", "", "",
+				fmt.Errorf("archive member %q appears more than once", rel)))
+			return nil
+		}
+		mem := &archiveMember{kind: h.kind, target: h.linkname}
+		switch {
+		case h.hardlink != "":
+			target, err := archiveRelPath(h.hardlink)
+			if err != nil {
+				unsafe = append(unsafe, newProblem(rel, ProblemUnsafePath, "", "", "",
+					fmt.Errorf("archive member %q is a hard link to a rejected name %q: %w", rel, h.hardlink, err)))
+				return nil
+			}
+			if t, ok := members[target]; ok && t.kind == manifest.TypeFile {
+				mem.size, mem.digests = t.size, t.digests
+			}
+			if hash(rel) {
+				prog.start(rel)
+				prog.add(mem.size)
+				prog.done()
+			}
+		case h.kind == manifest.TypeFile && hash(rel):
+			prog.start(rel)
+			d, n, err := hashing.HashReader(&ctxReader{ctx: ctx, r: r, t: prog}, digestAlgs(entryDigests(c.expected[rel])))
+			prog.done()
+			if err != nil {
+				return fmt.Errorf("read archive member %q: %w", rel, err)
+			}
+			mem.size, mem.digests = n, d
+		}
+		members[rel] = mem
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if _, ok := members[dir]; !ok {
+				members[dir] = &archiveMember{kind: manifest.TypeDir, implied: true}
+			}
+		}
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pr := range unsafe {
+		rep.add(pr)
+		if opts.FailFast {
+			return rep, nil
+		}
+	}
+	for _, p := range c.sorted {
+		pr := checkArchiveEntry(c.expected[p], members, c.follow())
+		rep.add(pr)
+		if pr != nil && opts.FailFast {
+			return rep, nil
+		}
+	}
+
+	if opts.Strict {
+		filter, scan, err := c.strictScan()
+		if err != nil {
+			return nil, err
+		}
+		actual := make(map[string]string, len(members))
+		for rel, mem := range members {
+			if archiveUnderSymlink(members, rel) != "" || filter.Excludes(rel, mem.kind == manifest.TypeDir) || underAny(scan.unreadable, rel) {
+				continue
+			}
+			switch {
+			case mem.kind == manifest.TypeDir && (!scan.dirs || !filter.IncludesDir(rel)),
+				mem.kind == manifest.TypeSymlink && !scan.links,
+				isSpecialKind(mem.kind) && !scan.special:
+				continue
+			}
+			actual[rel] = mem.kind
+		}
+		c.addExtras(actual, scan, opts.FailFast)
+	}
+	return rep, nil
+}
+
+// checkArchiveEntry compares one manifest entry with the archive members.
+// It mirrors checkEntry, minus the attribute checks.
+func checkArchiveEntry(fe manifest.FileEntry, members map[string]*archiveMember, follow bool) *Problem {
+	p := fe.Path
+	if at := archiveUnderSymlink(members, p); at != "" {
+		return newProblem(p, ProblemUnsafePath, "", "", at,
+			fmt.Errorf("input path %q crosses a symlink at %q", p, at))
+	}
+	mem, ok := members[p]
+	if !ok {
+		return newProblem(p, ProblemMissing, "", typeName(fe.Type), "",
+			fmt.Errorf("input missing %q: not in archive", p))
+	}
+
+	switch fe.Type {
+	case manifest.TypeDir:
+		if mem.kind != manifest.TypeDir {
+			return newProblem(p, ProblemTypeChanged, "type", manifest.TypeDir, typeName(mem.kind),
+				fmt.Errorf("input not a directory %q", p))
+		}
+		return nil
+	case manifest.TypeSymlink:
+		if mem.kind != manifest.TypeSymlink {
+			return newProblem(p, ProblemTypeChanged, "type", manifest.TypeSymlink, typeName(mem.kind),
+				fmt.Errorf("input not a symlink %q", p))
+		}
+		if mem.target != fe.Target {
+			return newProblem(p, ProblemModified, "target", fe.Target, mem.target,
+				fmt.Errorf("input symlink target mismatch for %q: expected %q got %q", p, fe.Target, mem.target))
+		}
+		return nil
+	}
+
+	if mem.kind == manifest.TypeSymlink && follow {
+		// Follow-mode pack: compare what the link points to, as Build did,
+		// as long as that stays inside the archive.
+		var pr *Problem
+		if mem, pr = resolveArchiveLink(fe, members); pr != nil {
+			return pr
+		}
+	}
+	if mem.kind != manifest.TypeFile {
+		return newProblem(p, ProblemTypeChanged, "type", typeName(manifest.TypeFile), typeName(mem.kind),
+			fmt.Errorf("input not a regular file %q", p))
+	}
+	if mem.digests == nil {
+		// Only the selected manifest files are hashed, so a hard link (or, in
+		// a follow-mode pack, a symlink) to any other member cannot be checked.
+		return newProblem(p, ProblemUnreadable, "", "", "",
+			fmt.Errorf("input unreadable %q: links to an archive member whose contents were not read", p))
+	}
+	if mem.size != fe.SizeBytes {
+		return newProblem(p, ProblemSizeChanged, "size_bytes", strconv.FormatInt(fe.SizeBytes, 10), strconv.FormatInt(mem.size, 10),
+			fmt.Errorf("input size mismatch for %q: expected %d got %d", p, fe.SizeBytes, mem.size))
+	}
+	return compareDigests(p, entryDigests(fe), mem.digests)
+}
+
+// resolveArchiveLink follows the symlink member at fe.Path to the member it
+// ends at, which must be inside the archive.
+func resolveArchiveLink(fe manifest.FileEntry, members map[string]*archiveMember) (*archiveMember, *Problem) {
+	cur := fe.Path
+	mem := members[cur]
+	for hops := 0; mem.kind == manifest.TypeSymlink; hops++ {
+		next := path.Join(path.Dir(cur), mem.target)
+		if hops == maxArchiveLinkHops || path.IsAbs(mem.target) || next == ".." || strings.HasPrefix(next, "../") {
+			return nil, newProblem(fe.Path, ProblemUnsafePath, "", "", "",
+				fmt.Errorf("input path %q resolves outside the input root", fe.Path))
+		}
+		var ok bool
+		if mem, ok = members[next]; !ok {
+			return nil, newProblem(fe.Path, ProblemMissing, "", typeName(fe.Type), "",
+				fmt.Errorf("input missing %q: symlink target %q not in archive", fe.Path, next))
+		}
+		cur = next
+	}
+	return mem, nil
+}
+
+// archiveUnderSymlink returns the first proper ancestor of rel that is a
+// symlink member, or "". Extracting such an archive would write through the
+// link.
+func archiveUnderSymlink(members map[string]*archiveMember, rel string) string {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		at := strings.Join(parts[:i], "/")
+		if m, ok := members[at]; ok && m.kind == manifest.TypeSymlink {
+			return at
+		}
+	}
+	return ""
+}
+
+// underAny reports whether rel or one of its ancestors is in set.
+func underAny(set map[string]bool, rel string) bool {
+	for p := rel; p != "."; p = path.Dir(p) {
+		if set[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveRelPath turns a member name into a clean relative manifest path
+// ("." for the archive root), rejecting names that could escape it.
+func archiveRelPath(name string) (string, error) {
+	switch {
+	case name == "":
+		return "", errors.New("empty name")
+	case strings.ContainsRune(name, 0):
+		return "", errors.New("NUL byte in name")
+	case strings.Contains(name, "\\"):
+		return "", errors.New("backslash in name")
+	case strings.HasPrefix(name, "/"), hasDriveLetter(name):
+		return "", errors.New("absolute name")
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == ".." {
+			return "", errors.New("path traversal not allowed")
+		}
+	}
+	return path.Clean(name), nil
+}
+
+// hasDriveLetter reports whether name starts with a Windows drive ("C:" or
+// "C:/..."; backslashes are rejected separately). Any other colon, as in
+// "a:b", is legal in a POSIX member name.
+func hasDriveLetter(name string) bool {
+	if len(name) < 2 || name[1] != ':' || len(name) > 2 && name[2] != '/' {
+		return false
+	}
+	c := name[0]
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isTarHeader reports whether b starts with a tar header block. POSIX and
+// GNU headers carry the "ustar" magic; old V7 headers do not, so the header
+// checksum is what identifies them.
+func isTarHeader(b []byte) bool {
+	if len(b) < 512 {
+		return false
+	}
+	if string(b[257:262]) == "ustar" {
+		return true
+	}
+	field := strings.TrimRight(strings.TrimLeft(string(b[148:156]), " "), " \x00")
+	want, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+	var sum int64
+	for i, c := range b[:512] {
+		if 148 <= i && i < 156 {
+			c = ' '
+		}
+		sum += int64(c)
+	}
+	return sum == want
+}
+
+// walkArchive calls fn for each member of the tar, tar.gz or zip archive at
+// p, in archive order. r reads the contents of a regular file member.
+func walkArchive(ctx context.Context, p string, fn func(h archiveHeader, r io.Reader) error) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(512)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("open archive: %w", err)
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return fmt.Errorf("read zip archive: %w", err)
+		}
+		return walkZip(ctx, zr, fn)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("read gzip archive: %w", err)
+		}
+		defer gz.Close()
+		return walkTar(ctx, tar.NewReader(gz), fn)
+	case isTarHeader(magic):
+		return walkTar(ctx, tar.NewReader(br), fn)
+	}
+	return usageErrorf("archive %s: not a tar, tar.gz or zip file", p)
+}
+
+func walkTar(ctx context.Context, tr *tar.Reader, fn func(h archiveHeader, r io.Reader) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar archive: %w", err)
+		}
+		h := archiveHeader{name: hdr.Name}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeGNUSparse:
+			h.kind = manifest.TypeFile
+		case tar.TypeDir:
+			h.kind = manifest.TypeDir
+		case tar.TypeSymlink:
+			h.kind, h.linkname = manifest.TypeSymlink, hdr.Linkname
+		case tar.TypeLink:
+			h.kind, h.hardlink = manifest.TypeFile, hdr.Linkname
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			h.kind = specialKind(hdr.FileInfo().Mode().Type())
+		}
+		if err := fn(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(ctx context.Context, zr *zip.Reader, fn func(h archiveHeader, r io.Reader) error) error {
+	for _, zf := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		h := archiveHeader{name: zf.Name}
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			h.kind = manifest.TypeDir
+		case mode.IsRegular():
+			h.kind = manifest.TypeFile
+		case mode&fs.ModeSymlink != 0:
+			h.kind = manifest.TypeSymlink
+		default:
+			h.kind = specialKind(mode.Type())
+		}
+		if err := walkZipMember(zf, h, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipMember(zf *zip.File, h archiveHeader, fn func(h archiveHeader, r io.Reader) error) error {
+	if h.kind != manifest.TypeFile && h.kind != manifest.TypeSymlink {
+		return fn(h, nil)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("read archive member %q: %w", zf.Name, err)
+	}
+	defer rc.Close()
+	if h.kind == manifest.TypeSymlink {
+		// zip stores a symlink's target as its contents.
+		target, err := io.ReadAll(io.LimitReader(rc, maxArchiveLinkTarget+1))
+		if err != nil {
+			return fmt.Errorf("read archive member %q: %w", zf.Name, err)
+		}
+		if len(target) > maxArchiveLinkTarget {
+			return fmt.Errorf("read archive member %q: symlink target too long", zf.Name)
+		}
+		h.linkname = string(target)
+		return fn(h, nil)
+	}
+	return fn(h, rc)
+}
@@ -0,0 +1,250 @@
+package auditpack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// AttestationFile is the in-toto Statement written by a build with
+// Options.Attest. It is derived from manifest.json and run_meta.json, so it
+// is not listed in the pack checksum files; VerifyAttestation ties it back to
+// the manifest.
+const AttestationFile = "attestation.intoto.json"
+
+// in-toto and SLSA identifiers.
+const (
+	StatementType      = "https://in-toto.io/Statement/v1"
+	SLSAProvenanceType = "https://slsa.dev/provenance/v1"
+	// AttestationBuildType identifies auditpack runs in the provenance.
+	AttestationBuildType = "https://github.com/nicholaskarlson/proof-first-auditpack/run/v1"
+	// attestationBuilderID identifies the tool that wrote the provenance.
+	attestationBuilderID = "https://github.com/nicholaskarlson/proof-first-auditpack"
+)
+
+// KindAttestationMismatch reports an attestation whose subjects differ from
+// manifest.json.
+const KindAttestationMismatch = "attestation_mismatch"
+
+// Statement is an in-toto v1 Statement.
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Subject is an in-toto ResourceDescriptor naming one packed file.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is the SLSA v1 provenance predicate of a pack attestation.
+type Provenance struct {
+	BuildDefinition struct {
+		BuildType          string          `json:"buildType"`
+		ExternalParameters BuildParameters `json:"externalParameters"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+}
+
+// BuildParameters are the run settings that shaped the manifest, with
+// defaults spelled out.
+type BuildParameters struct {
+	Input      string           `json:"input"`
+	Filter     *manifest.Filter `json:"filter,omitempty"`
+	Symlinks   string           `json:"symlinks"`
+	OnSpecial  string           `json:"on_special"`
+	OnError    string           `json:"on_error"`
+	RecordDirs bool             `json:"record_dirs"`
+	Capture    []string         `json:"capture,omitempty"`
+	Digests    []string         `json:"digests"`
+}
+
+// intotoDigestName maps an auditpack digest name to its in-toto DigestSet
+// name ("sha3-256" is "sha3_256" there).
+func intotoDigestName(alg string) string {
+	return strings.ReplaceAll(alg, "-", "_")
+}
+
+// subjectDigest returns the in-toto digest set of fe; nil for entries that
+// are not subjects. Directories have no digest, and a symlink entry's digest
+// is of its link text, which in-toto consumers would take for the content of
+// the file it points to, so neither is attested.
+func subjectDigest(fe manifest.FileEntry) map[string]string {
+	if fe.Type == manifest.TypeSymlink || (fe.SHA256 == "" && len(fe.Digests) == 0) {
+		return nil
+	}
+	d := make(map[string]string, len(fe.Digests)+1)
+	if fe.SHA256 != "" {
+		d[intotoDigestName(hashing.SHA256)] = fe.SHA256
+	}
+	for alg, sum := range fe.Digests {
+		d[intotoDigestName(alg)] = sum
+	}
+	return d
+}
+
+// buildStatement renders the attestation for a manifest and its run
+// metadata. Subjects follow manifest order, so the output is deterministic.
+func buildStatement(m manifest.Manifest, meta manifest.RunMeta, algs []string) ([]byte, error) {
+	var p Provenance
+	p.BuildDefinition.BuildType = AttestationBuildType
+	p.BuildDefinition.ExternalParameters = BuildParameters{
+		Input:      meta.Input,
+		Filter:     meta.Filter,
+		Symlinks:   string(SymlinksSkip),
+		OnSpecial:  string(SpecialSkip),
+		OnError:    string(ErrorsFail),
+		RecordDirs: meta.RecordDirs,
+		Capture:    meta.Capture,
+		Digests:    algs,
+	}
+	params := &p.BuildDefinition.ExternalParameters
+	if meta.Symlinks != "" {
+		params.Symlinks = meta.Symlinks
+	}
+	if meta.OnSpecial != "" {
+		params.OnSpecial = meta.OnSpecial
+	}
+	if meta.OnError != "" {
+		params.OnError = meta.OnError
+	}
+	p.RunDetails.Builder.ID = attestationBuilderID
+	p.RunDetails.Builder.Version = map[string]string{meta.Tool: meta.Version}
+
+	pred, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	st := Statement{Type: StatementType, Subject: []Subject{}, PredicateType: SLSAProvenanceType, Predicate: pred}
+	for _, fe := range m.Files {
+		if d := subjectDigest(fe); d != nil {
+			st.Subject = append(st.Subject, Subject{Name: fe.Path, Digest: d})
+		}
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// VerifyAttestation checks the pack with VerifyPackContext, then that the
+// in-toto Statement in data names exactly its regular-file manifest entries,
+// with exactly their digests. It returns the number of subjects. The
+// predicate is not interpreted.
+func VerifyAttestation(ctx context.Context, outDir string, data []byte) (n int, err error) {
+	defer func() { err = asIntegrity(err) }()
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return 0, err
+	}
+	return checkAttestation(outDir, data)
+}
+
+// checkAttestation is VerifyAttestation for a pack that has been verified.
+func checkAttestation(outDir string, data []byte) (n int, err error) {
+	defer func() { err = asIntegrity(err) }()
+	b, err := os.ReadFile(filepath.Join(outDir, "manifest.json"))
+	if err != nil {
+		return 0, fmt.Errorf("read manifest.json: %w", err)
+	}
+	var m manifest.Manifest
+	if err := decodeStrict(b, &m); err != nil {
+		return 0, fmt.Errorf("parse manifest.json: %w", err)
+	}
+	mismatch := func(path, format string, args ...any) error {
+		return &IntegrityError{Path: path, Kind: KindAttestationMismatch, Err: fmt.Errorf("attestation: "+format, args...)}
+	}
+
+	var st Statement
+	if err := json.Unmarshal(data, &st); err != nil {
+		return 0, mismatch("", "not an in-toto Statement: %v", err)
+	}
+	if st.Type != StatementType {
+		return 0, mismatch("", "_type is %q, want %q", st.Type, StatementType)
+	}
+
+	want := make(map[string]map[string]string, len(m.Files))
+	for _, fe := range m.Files {
+		if d := subjectDigest(fe); d != nil {
+			want[fe.Path] = d
+		}
+	}
+	seen := make(map[string]bool, len(st.Subject))
+	for _, s := range st.Subject {
+		if seen[s.Name] {
+			return 0, mismatch(s.Name, "subject %q is listed more than once", s.Name)
+		}
+		seen[s.Name] = true
+		d, ok := want[s.Name]
+		if !ok {
+			return 0, mismatch(s.Name, "subject %q is not a manifest entry with a digest", s.Name)
+		}
+		if err := compareDigestSets(d, s.Digest); err != nil {
+			return 0, mismatch(s.Name, "subject %q: %v", s.Name, err)
+		}
+	}
+	var missing []string
+	for p := range want {
+		if !seen[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return 0, mismatch(missing[0], "%d manifest entries are not subjects, first %q", len(missing), missing[0])
+	}
+	return len(st.Subject), nil
+}
+
+// compareDigestSets requires got to hold exactly the algorithms and values of
+// want.
+func compareDigestSets(want, got map[string]string) error {
+	for alg, sum := range want {
+		g, ok := got[alg]
+		switch {
+		case !ok:
+			return fmt.Errorf("no %s digest", alg)
+		case g != sum:
+			return fmt.Errorf("%s digest %s does not match manifest %s", alg, g, sum)
+		}
+	}
+	for alg := range got {
+		if _, ok := want[alg]; !ok {
+			return fmt.Errorf("unexpected %s digest (not in manifest.json)", alg)
+		}
+	}
+	return nil
+}
+
+// writeAttestation writes AttestationFile, or removes a stale one when attest
+// is false.
+func writeAttestation(outDir string, attest bool, m manifest.Manifest, meta manifest.RunMeta, algs []string) error {
+	if !attest {
+		if err := os.Remove(filepath.Join(outDir, AttestationFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := buildStatement(m, meta, algs)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(outDir, AttestationFile, b)
+}
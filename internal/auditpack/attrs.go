@@ -0,0 +1,148 @@
+package auditpack
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// Metadata attributes that can be captured with Options.Capture.
+const (
+	AttrMode  = "mode"
+	AttrMTime = "mtime"
+	AttrUID   = "uid"
+	AttrGID   = "gid"
+)
+
+// allAttrs is the canonical attribute order used in run_meta.json.
+var allAttrs = []string{AttrMode, AttrMTime, AttrUID, AttrGID}
+
+// ParseAttrs parses a comma-separated attribute list (e.g. "mode,mtime") into
+// canonical order without duplicates. An empty string yields nil.
+func ParseAttrs(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	want := map[string]bool{}
+	for _, a := range strings.Split(s, ",") {
+		a = strings.TrimSpace(a)
+		if !isAttr(a) {
+			return nil, usageErrorf("invalid attribute %q (want mode,mtime,uid,gid)", a)
+		}
+		want[a] = true
+	}
+	out := make([]string, 0, len(want))
+	for _, a := range allAttrs {
+		if want[a] {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func isAttr(a string) bool {
+	for _, x := range allAttrs {
+		if a == x {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// formatMode renders permission bits plus setuid/setgid/sticky in the usual
+// four-digit octal form.
+func formatMode(m fs.FileMode) string {
+	v := uint32(m.Perm())
+	if m&fs.ModeSetuid != 0 {
+		v |= 0o4000
+	}
+	if m&fs.ModeSetgid != 0 {
+		v |= 0o2000
+	}
+	if m&fs.ModeSticky != 0 {
+		v |= 0o1000
+	}
+	return fmt.Sprintf("%04o", v)
+}
+
+func formatMTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// captureAttrs fills the requested metadata fields of fe from info.
+func captureAttrs(fe *manifest.FileEntry, info fs.FileInfo, attrs []string) error {
+	for _, a := range attrs {
+		switch a {
+		case AttrMode:
+			fe.Mode = formatMode(info.Mode())
+		case AttrMTime:
+			fe.MTime = formatMTime(info.ModTime())
+		case AttrUID, AttrGID:
+			uid, gid, ok := fileOwner(info)
+			if !ok {
+				return usageErrorf("capture %s: file ownership is not available on this platform", a)
+			}
+			if a == AttrUID {
+				fe.UID = &uid
+			} else {
+				fe.GID = &gid
+			}
+		}
+	}
+	return nil
+}
+
+// checkAttrs compares the metadata recorded in fe against info, skipping
+// attributes listed in ignore and attributes the pack did not capture.
+func checkAttrs(fe manifest.FileEntry, info fs.FileInfo, ignore []string) *Problem {
+	if fe.Mode != "" && !contains(ignore, AttrMode) {
+		if got := formatMode(info.Mode()); got != fe.Mode {
+			return newProblem(fe.Path, ProblemAttrChanged, AttrMode, fe.Mode, got,
+				fmt.Errorf("input mode mismatch for %q: expected %s got %s", fe.Path, fe.Mode, got))
+		}
+	}
+	if fe.MTime != "" && !contains(ignore, AttrMTime) {
+		if got := formatMTime(info.ModTime()); got != fe.MTime {
+			return newProblem(fe.Path, ProblemAttrChanged, AttrMTime, fe.MTime, got,
+				fmt.Errorf("input mtime mismatch for %q: expected %s got %s", fe.Path, fe.MTime, got))
+		}
+	}
+	if fe.UID == nil && fe.GID == nil {
+		return nil
+	}
+	uid, gid, ok := fileOwner(info)
+	if fe.UID != nil && !contains(ignore, AttrUID) {
+		if !ok {
+			return newProblem(fe.Path, ProblemUnreadable, AttrUID, "", "",
+				fmt.Errorf("input uid for %q: file ownership is not available on this platform", fe.Path))
+		}
+		if uid != *fe.UID {
+			return newProblem(fe.Path, ProblemAttrChanged, AttrUID, strconv.Itoa(*fe.UID), strconv.Itoa(uid),
+				fmt.Errorf("input uid mismatch for %q: expected %d got %d", fe.Path, *fe.UID, uid))
+		}
+	}
+	if fe.GID != nil && !contains(ignore, AttrGID) {
+		if !ok {
+			return newProblem(fe.Path, ProblemUnreadable, AttrGID, "", "",
+				fmt.Errorf("input gid for %q: file ownership is not available on this platform", fe.Path))
+		}
+		if gid != *fe.GID {
+			return newProblem(fe.Path, ProblemAttrChanged, AttrGID, strconv.Itoa(*fe.GID), strconv.Itoa(gid),
+				fmt.Errorf("input gid mismatch for %q: expected %d got %d", fe.Path, *fe.GID, gid))
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package auditpack
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,9 +11,12 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/checksums"
 	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
 	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/pathfilter"
 )
 
 type Options struct {
@@ -21,6 +25,53 @@ type Options struct {
 	// InputLabel is written into manifest/meta instead of the raw inDir path.
 	// Use this to keep outputs stable even if inDir is absolute.
 	InputLabel string
+	// Jobs bounds the number of files hashed concurrently. <= 0 means one
+	// worker per CPU. The manifest is identical for every value.
+	Jobs int
+	// Include and Exclude are glob patterns ("**" matches any number of path
+	// segments) applied together with the input root's .auditpackignore file.
+	// When Include is non-empty, only matching files are packed.
+	Include []string
+	Exclude []string
+	// Symlinks is the symlink policy; empty means SymlinksSkip.
+	Symlinks SymlinkPolicy
+	// OnSpecial is the policy for sockets, FIFOs, devices and other
+	// non-regular files; empty means SpecialSkip.
+	OnSpecial SpecialPolicy
+	// OnError is the policy for input paths that cannot be read; empty means
+	// ErrorsFail. ErrorsRecord produces an incomplete pack instead of failing.
+	OnError ErrorPolicy
+	// RecordDirs adds a "dir" entry for every directory under the input root,
+	// so empty directories are part of the record.
+	RecordDirs bool
+	// Capture lists metadata attributes (AttrMode, AttrMTime, AttrUID,
+	// AttrGID) to record on every entry. Empty keeps entries content-only.
+	Capture []string
+	// Digests lists the hash algorithms computed per file in one read pass
+	// (see hashing.Names). Empty means sha256 only. One pack checksum file
+	// (manifest.<algorithm>) is written per algorithm.
+	Digests []string
+	// Baseline is a previous pack whose digests are reused for files whose
+	// size, mtime, inode and ctime are unchanged. The manifest is identical to
+	// a full rebuild. Paranoid ignores the baseline and re-hashes everything.
+	Baseline string
+	Paranoid bool
+	// Progress, if set, receives snapshots while files are hashed.
+	Progress ProgressFunc
+	// StatCache writes stat_cache.json so this pack can serve as a Baseline
+	// later. It is implied by Baseline.
+	StatCache bool
+	// Warn, if set, receives notices that do not fail the build, such as a
+	// Baseline without a stat cache (every file is then re-hashed) or the
+	// removal of signatures the rebuild invalidated.
+	Warn func(msg string)
+	// Retry is how often a file that changed while it was being hashed is
+	// read again. When it is still changing the build fails with an
+	// *UnstableError, or, with ErrorsRecord, lists it with class "unstable".
+	Retry RetryPolicy
+	// Attest writes AttestationFile, an in-toto Statement with SLSA
+	// provenance whose subjects are the manifest entries and their digests.
+	Attest bool
 }
 
 func DefaultOptions() Options {
@@ -28,12 +79,21 @@ func DefaultOptions() Options {
 		Tool:       "proof-first-auditpack",
 		Version:    "dev",
 		InputLabel: "",
+		Retry:      DefaultRetryPolicy,
 	}
 }
 
+// Build writes an audit pack for inDir into outDir.
 func Build(inDir, outDir string, opts Options) error {
+	return BuildContext(context.Background(), inDir, outDir, opts)
+}
+
+// BuildContext is Build with cancellation: once ctx is done no new files are
+// hashed, in-flight reads stop, no pack files are written and ctx.Err() is
+// returned.
+func BuildContext(ctx context.Context, inDir, outDir string, opts Options) error {
 	if inDir == "" {
-		return errors.New("inDir is required")
+		return usageErrorf("inDir is required")
 	}
 
 	info, err := os.Stat(inDir)
@@ -41,7 +101,7 @@ func Build(inDir, outDir string, opts Options) error {
 		return err
 	}
 	if !info.IsDir() {
-		return fmt.Errorf("input is not a directory: %s", inDir)
+		return usageErrorf("input is not a directory: %s", inDir)
 	}
 
 	label := opts.InputLabel
@@ -64,7 +124,7 @@ func Build(inDir, outDir string, opts Options) error {
 				relOut = filepath.ToSlash(relOut)
 				relOut = path.Clean(relOut)
 				if relOut == "." {
-					return fmt.Errorf("outDir must not equal inDir: %s", outDir)
+					return usageErrorf("outDir must not equal inDir: %s", outDir)
 				}
 				// If outDir is under inDir, relOut will not start with ../
 				if relOut != ".." && !strings.HasPrefix(relOut, "../") {
@@ -74,37 +134,87 @@ func Build(inDir, outDir string, opts Options) error {
 		}
 	}
 
-	entries := make([]manifest.FileEntry, 0, 64)
-	var totalBytes int64
+	filter, mf, err := loadFilter(inDir, opts.Include, opts.Exclude)
+	if err != nil {
+		return err
+	}
 
-	walkErr := filepath.WalkDir(inDir, func(p string, d fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
+	symlinks, err := ParseSymlinkPolicy(string(opts.Symlinks))
+	if err != nil {
+		return err
+	}
+	onSpecial, err := ParseSpecialPolicy(string(opts.OnSpecial))
+	if err != nil {
+		return err
+	}
+	onError, err := ParseErrorPolicy(string(opts.OnError))
+	if err != nil {
+		return err
+	}
+	capture, err := ParseAttrs(strings.Join(opts.Capture, ","))
+	if err != nil {
+		return err
+	}
+	algs, err := resolveDigests(opts.Digests)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	writeCache := opts.StatCache || opts.Baseline != ""
+	var baseline map[string]baselineEntry
+	if opts.Baseline != "" && !opts.Paranoid {
+		baseline, err = loadBaseline(opts.Baseline, algs)
+		switch {
+		case errors.Is(err, errNoStatCache):
+			if opts.Warn != nil {
+				opts.Warn(err.Error() + "; re-hashing every file")
+			}
+		case err != nil:
+			return err
 		}
+	}
+	rootReal := ""
+	if symlinks == SymlinksFollow {
+		if rootReal, err = filepath.EvalSymlinks(inDir); err != nil {
+			return err
+		}
+	}
 
-		// Exclude outDir subtree when outDir is within inDir.
-		if excludeRel != "" {
+	// Walk first (serial, cheap), then hash the collected files with a bounded
+	// worker pool. Each worker writes into its own slot, so the result does not
+	// depend on scheduling order.
+	type pending struct {
+		abs string
+		rel string
+		typ string // manifest entry type; only TypeFile entries are hashed
+	}
+	todo := make([]pending, 0, 64)
+	// bytesTotal is only needed for progress reports; it is summed during the
+	// walk rather than in a second stat pass.
+	var bytesTotal int64
+	var skipped []manifest.SkippedEntry
+	specials := 0
+	var unreadable []manifest.ErrorEntry
+
+	walkErr := filepath.WalkDir(inDir, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			// Under --on-error=record an unreadable path below the root is
+			// listed instead of ending the walk; its subtree is not visited.
+			if onError != ErrorsRecord || p == inDir || !IsIOError(walkErr) {
+				return walkErr
+			}
 			rel, err := filepath.Rel(inDir, p)
 			if err != nil {
 				return err
 			}
-			rel = filepath.ToSlash(rel)
-			rel = path.Clean(rel)
-
-			if rel == excludeRel || strings.HasPrefix(rel, excludeRel+"/") {
-				if d.IsDir() {
-					return fs.SkipDir
-				}
-				return nil
+			unreadable = append(unreadable, manifest.ErrorEntry{Path: path.Clean(filepath.ToSlash(rel)), Class: errorClass(walkErr)})
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
 			}
-		}
-
-		if d.IsDir() {
 			return nil
 		}
-		// Only regular files.
-		if !d.Type().IsRegular() {
-			return nil
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
 		rel, err := filepath.Rel(inDir, p)
@@ -114,40 +224,242 @@ func Build(inDir, outDir string, opts Options) error {
 		// Normalize to forward slashes for cross-platform stability.
 		rel = filepath.ToSlash(rel)
 		rel = path.Clean(rel)
+		if rel == "." {
+			return nil
+		}
 
-		h, err := hashing.SHA256File(p)
-		if err != nil {
-			return err
+		// Exclude outDir subtree when outDir is within inDir.
+		if excludeRel != "" && (rel == excludeRel || strings.HasPrefix(rel, excludeRel+"/")) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		// Apply --include/--exclude and .auditpackignore.
+		if filter.Excludes(rel, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if opts.RecordDirs && filter.IncludesDir(rel) {
+				todo = append(todo, pending{abs: p, rel: rel, typ: manifest.TypeDir})
+			}
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			switch symlinks {
+			case SymlinksRecord:
+				todo = append(todo, pending{abs: p, rel: rel, typ: manifest.TypeSymlink})
+			case SymlinksFollow:
+				resolved, size, err := resolveFollow(rootReal, p, rel)
+				if err != nil {
+					return err
+				}
+				todo = append(todo, pending{abs: resolved, rel: rel})
+				bytesTotal += size
+			case SymlinksError:
+				return policyErrorf(rel, "--symlinks=error", "symlink not allowed (--symlinks=error): %q", rel)
+			}
+			return nil
+		}
+
+		// Only regular files are hashed; anything else is a special file.
+		if !d.Type().IsRegular() {
+			kind := specialKind(d.Type())
+			specials++
+			switch onSpecial {
+			case SpecialRecord:
+				skipped = append(skipped, manifest.SkippedEntry{Path: rel, Kind: kind})
+			case SpecialError:
+				return policyErrorf(rel, "--on-special=error", "special file not allowed (--on-special=error): %q (%s)", rel, kind)
+			}
+			return nil
 		}
 
-		entries = append(entries, manifest.FileEntry{
-			Path:      rel,
-			SizeBytes: h.SizeBytes,
-			SHA256:    h.SHA256,
-		})
-		totalBytes += h.SizeBytes
+		todo = append(todo, pending{abs: p, rel: rel})
+		if opts.Progress != nil {
+			if info, err := d.Info(); err == nil {
+				bytesTotal += info.Size()
+			}
+		}
 		return nil
 	})
 	if walkErr != nil {
 		return walkErr
 	}
-	if len(entries) == 0 {
+	if len(todo) == 0 && len(unreadable) == 0 {
 		return fmt.Errorf("no files found under input directory: %s", inDir)
 	}
 
+	var prog *tracker
+	if opts.Progress != nil {
+		prog = newTracker(opts.Progress, "build", len(todo), bytesTotal)
+	}
+
+	entries := make([]manifest.FileEntry, len(todo))
+	reused := make([]bool, len(todo))
+	cache := make([]*statCacheEntry, len(todo))
+	failed := make([]string, len(todo)) // error class per slot, under ErrorsRecord
+	process := func(i int) error {
+		prog.start(todo[i].rel)
+		defer prog.done()
+
+		fe := manifest.FileEntry{Path: todo[i].rel, Type: todo[i].typ}
+		switch todo[i].typ {
+		case manifest.TypeDir:
+		case manifest.TypeSymlink:
+			target, err := readLinkTarget(todo[i].abs)
+			if err != nil {
+				return err
+			}
+			d, err := hashing.HashBytes([]byte(target), algs)
+			if err != nil {
+				return err
+			}
+			fe.Target = target
+			fe.SizeBytes = int64(len(target))
+			setEntryDigests(&fe, d)
+		default:
+			// Stat before hashing: if the file changes while it is read, its
+			// ctime moves past the cached value and the next build re-hashes it.
+			var key statKey
+			haveKey := false
+			if writeCache {
+				info, err := os.Stat(todo[i].abs)
+				if err != nil {
+					return err
+				}
+				key, haveKey = fileStatKey(info)
+			}
+			if be, ok := baseline[todo[i].rel]; ok && haveKey && be.key == key {
+				fe.SizeBytes = be.size
+				setEntryDigests(&fe, be.digests)
+				reused[i] = true
+				prog.add(be.size)
+			} else {
+				d, n, info, err := hashFileStable(ctx, todo[i].abs, todo[i].rel, nil, algs, prog, opts.Retry)
+				if err != nil {
+					return err
+				}
+				fe.SizeBytes = n
+				setEntryDigests(&fe, d)
+				if haveKey {
+					// Cache the state the digest was taken from.
+					key, haveKey = fileStatKey(info)
+				}
+			}
+			if haveKey && key.cacheable(start) {
+				cache[i] = &statCacheEntry{
+					Path:    todo[i].rel,
+					Size:    key.Size,
+					MTimeNS: key.MTimeNS,
+					CTimeNS: key.CTimeNS,
+					Inode:   key.Inode,
+					Dev:     key.Dev,
+				}
+			}
+		}
+		if len(capture) > 0 {
+			info, err := os.Lstat(todo[i].abs)
+			if err != nil {
+				return err
+			}
+			if err := captureAttrs(&fe, info, capture); err != nil {
+				return err
+			}
+		}
+		entries[i] = fe
+		return nil
+	}
+	err = parallelFor(ctx, len(todo), opts.Jobs, func(i int) error {
+		err := process(i)
+		if err != nil && onError == ErrorsRecord && ctx.Err() == nil && (IsIOError(err) || errors.Is(err, ErrUnstable)) {
+			failed[i] = errorClass(err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Drop the slots that failed; their paths go to the errors section.
+	inc := manifest.Incremental{Paranoid: opts.Paranoid}
+	kept := entries[:0]
+	for i, fe := range entries {
+		if failed[i] != "" {
+			unreadable = append(unreadable, manifest.ErrorEntry{Path: todo[i].rel, Class: failed[i]})
+			cache[i] = nil
+			continue
+		}
+		if reused[i] {
+			inc.Reused++
+		} else if fe.Type == manifest.TypeFile {
+			inc.Rehashed++
+		}
+		kept = append(kept, fe)
+	}
+	entries = kept
+	if len(entries) == 0 {
+		return fmt.Errorf("no readable files under input directory: %s", inDir)
+	}
+
+	var totalBytes int64
+	fileCount, dirCount, symlinkCount := 0, 0, 0
+	for _, fe := range entries {
+		totalBytes += fe.SizeBytes
+		switch fe.Type {
+		case manifest.TypeDir:
+			dirCount++
+		case manifest.TypeSymlink:
+			symlinkCount++
+		default:
+			fileCount++
+		}
+	}
+
+	var cacheEntries []statCacheEntry
+	for _, ce := range cache {
+		if ce != nil {
+			cacheEntries = append(cacheEntries, *ce)
+		}
+	}
+	sort.Slice(cacheEntries, func(i, j int) bool {
+		return strings.Compare(cacheEntries[i].Path, cacheEntries[j].Path) < 0
+	})
+
 	sort.Slice(entries, func(i, j int) bool {
 		return strings.Compare(entries[i].Path, entries[j].Path) < 0
 	})
 
+	sort.Slice(skipped, func(i, j int) bool {
+		return strings.Compare(skipped[i].Path, skipped[j].Path) < 0
+	})
+
+	sort.Slice(unreadable, func(i, j int) bool {
+		return strings.Compare(unreadable[i].Path, unreadable[j].Path) < 0
+	})
+
 	sum := manifest.Summary{
-		FileCount:  len(entries),
-		TotalBytes: totalBytes,
+		FileCount:    fileCount,
+		TotalBytes:   totalBytes,
+		SkippedCount: specials,
+		DirCount:     dirCount,
+		SymlinkCount: symlinkCount,
+		ErrorCount:   len(unreadable),
 	}
 
 	m := manifest.Manifest{
 		Version: opts.Version,
 		Input:   label,
 		Files:   entries,
+		Skipped: skipped,
+		Errors:  unreadable,
 		Summary: sum,
 	}
 
@@ -155,8 +467,32 @@ func Build(inDir, outDir string, opts Options) error {
 		Tool:    opts.Tool,
 		Version: opts.Version,
 		Input:   label,
+		Filter:  mf,
 		Summary: sum,
 	}
+	if symlinks != SymlinksSkip {
+		meta.Symlinks = string(symlinks)
+	}
+	if onSpecial != SpecialSkip {
+		meta.OnSpecial = string(onSpecial)
+	}
+	if onError != ErrorsFail {
+		meta.OnError = string(onError)
+	}
+	meta.Incomplete = len(unreadable) > 0
+	meta.RecordDirs = opts.RecordDirs
+	meta.Capture = capture
+	if len(algs) != 1 || algs[0] != hashing.SHA256 {
+		meta.Digests = algs
+	}
+	if opts.Baseline != "" {
+		meta.Incremental = &inc
+	}
+
+	// Nothing has been written yet; a cancelled build leaves outDir untouched.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	manifestBytes, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
@@ -170,6 +506,10 @@ func Build(inDir, outDir string, opts Options) error {
 	}
 	metaBytes = append(metaBytes, '\n')
 
+	// Signatures cover manifest.sha256 and the attestation; keep the old
+	// ones to tell which signatures this build invalidates.
+	oldSums, oldStatement := signedPayloads(outDir)
+
 	if err := writeFileAtomic(outDir, "manifest.json", manifestBytes); err != nil {
 		return err
 	}
@@ -177,26 +517,83 @@ func Build(inDir, outDir string, opts Options) error {
 		return err
 	}
 
-	// Write manifest.sha256 containing checksums for manifest.json and run_meta.json
-	manHash, err := hashing.SHA256File(filepath.Join(outDir, "manifest.json"))
-	if err != nil {
+	// The stat cache is a sidecar for later --baseline builds; never leave a
+	// stale one from an earlier build in the same outDir.
+	covered := packDocuments
+	if writeCache {
+		if err := writeStatCache(outDir, opts.Tool, cacheEntries); err != nil {
+			return err
+		}
+		covered = append(append([]string(nil), packDocuments...), statCacheName)
+	} else if err := os.Remove(filepath.Join(outDir, statCacheName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
-	metaHash, err := hashing.SHA256File(filepath.Join(outDir, "run_meta.json"))
-	if err != nil {
-		return err
+
+	// Write manifest.<algorithm> (manifest.sha256 by default) containing
+	// checksums for manifest.json, run_meta.json and the stat cache, one file
+	// per algorithm. Checksum files for algorithms not chosen this time are
+	// removed so a rebuild into the same outDir never leaves stale ones behind.
+	for _, name := range hashing.Names() {
+		if !contains(algs, name) {
+			if err := os.Remove(filepath.Join(outDir, checksumFileName(name))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
 	}
+	for _, alg := range algs {
+		lines := make([]string, 0, len(covered))
+		for _, name := range covered {
+			sum, _, err := hashing.HashFile(filepath.Join(outDir, name), []string{alg})
+			if err != nil {
+				return err
+			}
+			lines = append(lines, checksums.Format(checksums.Entry{Sum: sum[alg], Name: name}))
+		}
+		sort.Strings(lines)
 
-	lines := []string{
-		fmt.Sprintf("%s  manifest.json", manHash.SHA256),
-		fmt.Sprintf("%s  run_meta.json", metaHash.SHA256),
+		sumBytes := []byte(strings.Join(lines, "\n") + "\n")
+		if err := writeFileAtomic(outDir, checksumFileName(alg), sumBytes); err != nil {
+			return err
+		}
 	}
-	sort.Strings(lines)
 
-	shaBytes := []byte(strings.Join(lines, "\n") + "\n")
-	if err := writeFileAtomic(outDir, "manifest.sha256", shaBytes); err != nil {
+	if err := writeAttestation(outDir, opts.Attest, m, meta, algs); err != nil {
+		return err
+	}
+	removed, err := removeStaleSignatures(outDir, oldSums, oldStatement)
+	if err != nil {
 		return err
 	}
+	if len(removed) > 0 && opts.Warn != nil {
+		opts.Warn(fmt.Sprintf("removed %d signature file(s) made over the previous pack: %s", len(removed), strings.Join(removed, ", ")))
+	}
 
 	return nil
 }
+
+// loadFilter combines the include/exclude patterns with the input root's
+// .auditpackignore (if any). The returned manifest.Filter is what run_meta.json
+// records; both are nil when no patterns are active so default packs are unchanged.
+func loadFilter(inDir string, include, exclude []string) (*pathfilter.Filter, *manifest.Filter, error) {
+	var ignore []string
+	b, err := os.ReadFile(filepath.Join(inDir, pathfilter.IgnoreFileName))
+	if err == nil {
+		ignore = pathfilter.ParseIgnoreFile(b)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("read %s: %w", pathfilter.IgnoreFileName, err)
+	}
+
+	if len(include) == 0 && len(exclude) == 0 && len(ignore) == 0 {
+		return nil, nil, nil
+	}
+	mf := &manifest.Filter{
+		Include: append([]string(nil), include...),
+		Exclude: append([]string(nil), exclude...),
+		Ignore:  ignore,
+	}
+	f, err := pathfilter.New(mf.Include, mf.Exclude, mf.Ignore)
+	if err != nil {
+		return nil, nil, &UsageError{Err: err}
+	}
+	return f, mf, nil
+}
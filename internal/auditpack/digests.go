@@ -0,0 +1,104 @@
+package auditpack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// checksumFileName is the pack-level checksum file for an algorithm
+// (manifest.sha256, manifest.sha512, ...).
+func checksumFileName(alg string) string {
+	return "manifest." + alg
+}
+
+// resolveDigests validates Options.Digests; empty means sha256 only.
+func resolveDigests(algs []string) ([]string, error) {
+	out, err := hashing.ParseNames(strings.Join(algs, ","))
+	if err != nil {
+		return nil, &UsageError{Err: err}
+	}
+	if len(out) == 0 {
+		out = []string{hashing.SHA256}
+	}
+	return out, nil
+}
+
+// setEntryDigests stores d on fe: SHA-256 in its own field, the rest in Digests.
+func setEntryDigests(fe *manifest.FileEntry, d hashing.Digests) {
+	for alg, sum := range d {
+		if alg == hashing.SHA256 {
+			fe.SHA256 = sum
+			continue
+		}
+		if fe.Digests == nil {
+			fe.Digests = make(map[string]string, len(d))
+		}
+		fe.Digests[alg] = sum
+	}
+}
+
+// entryDigests returns every digest recorded on fe, keyed by algorithm.
+func entryDigests(fe manifest.FileEntry) hashing.Digests {
+	out := make(hashing.Digests, len(fe.Digests)+1)
+	if fe.SHA256 != "" {
+		out[hashing.SHA256] = fe.SHA256
+	}
+	for alg, sum := range fe.Digests {
+		out[alg] = sum
+	}
+	return out
+}
+
+// digestAlgs lists the algorithms in d in canonical order.
+func digestAlgs(d hashing.Digests) []string {
+	out := make([]string, 0, len(d))
+	for _, alg := range hashing.Names() {
+		if _, ok := d[alg]; ok {
+			out = append(out, alg)
+		}
+	}
+	return out
+}
+
+// validateDigests checks that every recorded digest names a known algorithm
+// and has the right hex length.
+func validateDigests(fe manifest.FileEntry) error {
+	if _, ok := fe.Digests[hashing.SHA256]; ok {
+		return fmt.Errorf("manifest entry %q: sha256 must use the sha256 field, not digests", fe.Path)
+	}
+	d := entryDigests(fe)
+	if len(d) == 0 {
+		return fmt.Errorf("manifest entry %q: no digest recorded", fe.Path)
+	}
+	algs := make([]string, 0, len(d))
+	for alg := range d {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	for _, alg := range algs {
+		h, ok := hashing.Lookup(alg)
+		if !ok {
+			return fmt.Errorf("manifest entry %q: unknown digest algorithm %q", fe.Path, alg)
+		}
+		if !isHexLen(d[alg], h.HexLen()) {
+			return fmt.Errorf("manifest %s invalid for %q: %q", alg, fe.Path, d[alg])
+		}
+	}
+	return nil
+}
+
+// compareDigests reports the first algorithm (in canonical order) whose
+// recorded digest differs from got.
+func compareDigests(path string, want, got hashing.Digests) *Problem {
+	for _, alg := range digestAlgs(want) {
+		if got[alg] != want[alg] {
+			return newProblem(path, ProblemModified, alg, want[alg], got[alg],
+				fmt.Errorf("input %s mismatch for %q: expected %s got %s", alg, path, want[alg], got[alg]))
+		}
+	}
+	return nil
+}
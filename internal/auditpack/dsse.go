@@ -0,0 +1,184 @@
+package auditpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+// DSSE envelope files. Each wraps one pack file as its payload, so the
+// signed bytes and their type travel together with the signatures.
+const (
+	DSSEManifestFile    = "manifest.sha256.dsse.json"
+	DSSEAttestationFile = "attestation.intoto.dsse.json"
+)
+
+// DSSE payload types.
+const (
+	PayloadTypeChecksums = "application/vnd.auditpack.manifest-sha256+text"
+	PayloadTypeInToto    = "application/vnd.in-toto+json"
+)
+
+// What SignPackDSSE can sign.
+const (
+	DSSEManifest    = "manifest"    // manifest.sha256
+	DSSEAttestation = "attestation" // AttestationFile
+)
+
+// SignPackDSSE checks the pack with VerifyPackContext and adds signatures by
+// signers to the DSSE envelope for what (DSSEManifest or DSSEAttestation),
+// creating it if needed. Signatures already in the envelope are kept; an
+// envelope over an older payload is an error, not replaced. It returns the
+// envelope's file name.
+func SignPackDSSE(ctx context.Context, outDir, what string, signers []signing.Signer) (string, error) {
+	if len(signers) == 0 {
+		return "", usageErrorf("no DSSE signers given")
+	}
+	name, payloadType, err := dsseTarget(what)
+	if err != nil {
+		return "", err
+	}
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return "", err
+	}
+	payload, err := readDSSEPayload(outDir, payloadType)
+	if err != nil {
+		return "", err
+	}
+
+	env := signing.NewEnvelope(payloadType, payload)
+	b, err := os.ReadFile(filepath.Join(outDir, name))
+	switch {
+	case err == nil:
+		old, oldPayload, err := signing.ParseEnvelope(b)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		if old.PayloadType != payloadType || !bytes.Equal(oldPayload, payload) {
+			return "", fmt.Errorf("%s signs an earlier version of the pack; remove it to sign the current one", name)
+		}
+		env = old
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	for _, s := range signers {
+		if err := env.Sign(s); err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	out, err := env.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return name, writeFileAtomic(outDir, name, out)
+}
+
+func dsseTarget(what string) (name, payloadType string, err error) {
+	switch what {
+	case DSSEManifest:
+		return DSSEManifestFile, PayloadTypeChecksums, nil
+	case DSSEAttestation:
+		return DSSEAttestationFile, PayloadTypeInToto, nil
+	default:
+		return "", "", usageErrorf("unknown DSSE payload %q (want %s or %s)", what, DSSEManifest, DSSEAttestation)
+	}
+}
+
+// readDSSEPayload returns the pack file signed under payloadType. An
+// attestation must match the manifest before it is signed.
+func readDSSEPayload(outDir, payloadType string) ([]byte, error) {
+	if payloadType == PayloadTypeChecksums {
+		return readSignedChecksums(outDir)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, AttestationFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("pack has no %s to sign (build it with run --attest)", AttestationFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", AttestationFile, err)
+	}
+	if _, err := checkAttestation(outDir, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// DSSEReport is the outcome of VerifyPackDSSE.
+type DSSEReport struct {
+	PayloadType string                   `json:"payload_type"`
+	Signatures  []signing.SignatureCheck `json:"signatures"`
+}
+
+// VerifyPackDSSE checks the pack with VerifyPackContext, then a DSSE
+// envelope against it. The payload must be the pack's manifest.sha256
+// (PayloadTypeChecksums) or an in-toto Statement whose subjects match
+// manifest.json (PayloadTypeInToto), and every verifier must have at least
+// one valid signature in the envelope. Signatures by other keys are reported
+// but ignored.
+func VerifyPackDSSE(ctx context.Context, outDir string, envelope []byte, verifiers []signing.Verifier) (rep *DSSEReport, err error) {
+	defer func() { err = asIntegrity(err) }()
+	if len(verifiers) == 0 {
+		return nil, usageErrorf("no DSSE verification keys given")
+	}
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return nil, err
+	}
+	invalid := func(format string, args ...any) error {
+		return &IntegrityError{Kind: KindSignatureInvalid, Err: fmt.Errorf("DSSE envelope: "+format, args...)}
+	}
+	env, payload, err := signing.ParseEnvelope(envelope)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	switch env.PayloadType {
+	case PayloadTypeChecksums:
+		msg, err := readSignedChecksums(outDir)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(payload, msg) {
+			return nil, invalid("payload is not this pack's manifest.sha256")
+		}
+	case PayloadTypeInToto:
+		if _, err := checkAttestation(outDir, payload); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, invalid("unsupported payloadType %q", env.PayloadType)
+	}
+
+	checks, err := env.Check(verifiers)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	rep = &DSSEReport{PayloadType: env.PayloadType, Signatures: checks}
+	for _, v := range verifiers {
+		// A key may appear more than once (an envelope merged from several
+		// signing runs, say); one valid signature is enough.
+		var claimed *signing.SignatureCheck
+		satisfied := false
+		for i := range checks {
+			if checks[i].Valid && checks[i].VerifiedBy == v.KeyID() {
+				satisfied = true
+				break
+			}
+			if checks[i].KeyID == v.KeyID() && claimed == nil {
+				claimed = &checks[i]
+			}
+		}
+		switch {
+		case satisfied:
+		case claimed == nil:
+			return rep, &IntegrityError{Kind: KindSignatureMissing, Err: fmt.Errorf("DSSE envelope has no signature by key %s", v.KeyID())}
+		default:
+			return rep, invalid("signature by key %s: %s", v.KeyID(), claimed.Err)
+		}
+	}
+	return rep, nil
+}
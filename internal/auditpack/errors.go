@@ -0,0 +1,119 @@
+package auditpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Error classes. Every error returned by this package that is not an I/O
+// error (see IsIOError) or a context error matches at most one of these with
+// errors.Is.
+var (
+	// ErrIntegrity means a pack or input tree does not match what was
+	// recorded, or a pack is malformed. The error is an *IntegrityError.
+	ErrIntegrity = errors.New("integrity check failed")
+	// ErrUsage means invalid options or arguments. The error is a *UsageError.
+	ErrUsage = errors.New("invalid usage")
+	// ErrUnstable means a file kept changing while it was being hashed. The
+	// error is an *UnstableError.
+	ErrUnstable = errors.New("file unstable")
+	// ErrPolicy means the input holds a path that a build policy rejects,
+	// such as a symlink under --symlinks=error. The error is a *PolicyError.
+	ErrPolicy = errors.New("rejected by policy")
+)
+
+// Integrity error kinds for pack-level failures. Input-tree failures use the
+// Problem kinds (ProblemMissing, ProblemModified, ...).
+const (
+	KindChecksumMismatch = "checksum_mismatch" // a pack file does not match manifest.<alg>
+	KindInvalidPack      = "invalid_pack"      // a pack document is malformed or inconsistent
+)
+
+// IntegrityError describes a verification failure. Path is the pack file or
+// input path concerned (empty when the failure is not about one path).
+type IntegrityError struct {
+	Path string
+	Kind string
+	Err  error
+}
+
+func (e *IntegrityError) Error() string        { return e.Err.Error() }
+func (e *IntegrityError) Unwrap() error        { return e.Err }
+func (e *IntegrityError) Is(target error) bool { return target == ErrIntegrity }
+
+// UsageError reports an invalid option, flag value or argument.
+type UsageError struct {
+	Err error
+}
+
+func (e *UsageError) Error() string        { return e.Err.Error() }
+func (e *UsageError) Unwrap() error        { return e.Err }
+func (e *UsageError) Is(target error) bool { return target == ErrUsage }
+
+// UnstableError reports a file whose size, mtime or ctime (Field) changed
+// during each of Attempts reads, so no digest describes a real state of it.
+type UnstableError struct {
+	Path     string
+	Field    string
+	Attempts int
+}
+
+func (e *UnstableError) Error() string {
+	return fmt.Sprintf("file unstable: %s changed while it was being hashed (%s moved; %d attempts)", e.Path, e.Field, e.Attempts)
+}
+func (e *UnstableError) Is(target error) bool { return target == ErrUnstable }
+
+// PolicyError reports an input path rejected by Policy, the option in
+// force (e.g. "--symlinks=error" or "--on-special=error").
+type PolicyError struct {
+	Path   string
+	Policy string
+	Err    error
+}
+
+func (e *PolicyError) Error() string        { return e.Err.Error() }
+func (e *PolicyError) Unwrap() error        { return e.Err }
+func (e *PolicyError) Is(target error) bool { return target == ErrPolicy }
+
+func policyErrorf(path, policy, format string, args ...any) error {
+	return &PolicyError{Path: path, Policy: policy, Err: fmt.Errorf(format, args...)}
+}
+
+// MissingChecksumError reports a directory without any pack checksum file
+// (manifest.<algorithm>), usually because it is not a pack or does not exist.
+// It counts as an I/O error and matches fs.ErrNotExist.
+type MissingChecksumError struct {
+	Dir string
+}
+
+func (e *MissingChecksumError) Error() string {
+	return fmt.Sprintf("no pack checksum file (manifest.<algorithm>) found in %s", e.Dir)
+}
+func (e *MissingChecksumError) Is(target error) bool { return target == fs.ErrNotExist }
+
+func usageErrorf(format string, args ...any) error {
+	return &UsageError{Err: fmt.Errorf(format, args...)}
+}
+
+// IsIOError reports whether err is (or wraps) a filesystem failure: a
+// *fs.PathError, *os.LinkError, *os.SyscallError or *MissingChecksumError.
+func IsIOError(err error) bool {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var sysErr *os.SyscallError
+	var missing *MissingChecksumError
+	return errors.As(err, &pathErr) || errors.As(err, &linkErr) || errors.As(err, &sysErr) || errors.As(err, &missing)
+}
+
+// asIntegrity marks a verification error that is not already classified as
+// an I/O, usage, integrity or context error as an invalid pack.
+func asIntegrity(err error) error {
+	if err == nil || errors.Is(err, ErrIntegrity) || errors.Is(err, ErrUsage) || IsIOError(err) ||
+		errors.Is(err, ErrUnstable) || errors.Is(err, ErrPolicy) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &IntegrityError{Kind: KindInvalidPack, Err: err}
+}
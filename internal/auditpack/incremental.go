@@ -0,0 +1,152 @@
+package auditpack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// statCacheName is the sidecar file that lets a later build use this pack as a
+// baseline. It holds inode/ctime data that differs between machines and runs,
+// so it is not part of manifest.json, but the pack checksum files cover it:
+// an edited cache would otherwise make a later build reuse stale digests.
+const statCacheName = "stat_cache.json"
+
+// errNoStatCache means a baseline pack has no stat cache; BuildContext then
+// re-hashes every file.
+var errNoStatCache = errors.New("baseline pack has no " + statCacheName)
+
+// racyWindow guards against a file being rewritten within the filesystem's
+// timestamp granularity right around the time it was stat'ed: files modified
+// this close to the start of a build are never cached, so they are always
+// re-hashed next time.
+const racyWindow = 2 * time.Second
+
+// statKey is what must be unchanged for a baseline digest to be reused.
+type statKey struct {
+	Size    int64
+	MTimeNS int64
+	CTimeNS int64
+	Inode   uint64
+	Dev     uint64
+}
+
+type statCacheEntry struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size_bytes"`
+	MTimeNS int64  `json:"mtime_ns"`
+	CTimeNS int64  `json:"ctime_ns"`
+	Inode   uint64 `json:"inode"`
+	Dev     uint64 `json:"dev"`
+}
+
+type statCache struct {
+	Tool  string           `json:"tool"`
+	Files []statCacheEntry `json:"files"`
+}
+
+func (e statCacheEntry) key() statKey {
+	return statKey{Size: e.Size, MTimeNS: e.MTimeNS, CTimeNS: e.CTimeNS, Inode: e.Inode, Dev: e.Dev}
+}
+
+// cacheable reports whether k is old enough (relative to the build start) to
+// be trusted by a later build.
+func (k statKey) cacheable(start time.Time) bool {
+	limit := start.Add(-racyWindow).UnixNano()
+	return k.MTimeNS < limit && k.CTimeNS < limit
+}
+
+// baselineEntry is a reusable digest set from a previous pack.
+type baselineEntry struct {
+	key     statKey
+	size    int64
+	digests hashing.Digests
+}
+
+// loadBaseline reads a previous pack for digest reuse. The pack must pass
+// VerifyPack, and its stat cache must be covered by every checksum file; a
+// pack without a stat cache is reported as errNoStatCache. Only regular-file
+// entries whose recorded digests cover every algorithm in algs are returned.
+func loadBaseline(dir string, algs []string) (map[string]baselineEntry, error) {
+	if err := VerifyPack(dir); err != nil {
+		return nil, fmt.Errorf("baseline pack: %w", err)
+	}
+	m, err := VerifyManifestSummary(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("baseline pack: %w", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, statCacheName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w (build it with --stat-cache or --baseline): %s", errNoStatCache, dir)
+		}
+		return nil, fmt.Errorf("read baseline %s: %w", statCacheName, err)
+	}
+	// VerifyPack has checked every file the checksum files list; make sure
+	// the cache is one of them.
+	packAlgs, err := packChecksumAlgs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("baseline pack: %w", err)
+	}
+	for _, alg := range packAlgs {
+		covered, err := verifyChecksumFile(dir, alg)
+		if err != nil {
+			return nil, fmt.Errorf("baseline pack: %w", err)
+		}
+		if !contains(covered, statCacheName) {
+			return nil, fmt.Errorf("baseline %s is not covered by %s; rebuild the baseline pack with --stat-cache: %s",
+				statCacheName, checksumFileName(alg), dir)
+		}
+	}
+	var sc statCache
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return nil, fmt.Errorf("parse baseline %s: %w", statCacheName, err)
+	}
+	keys := make(map[string]statKey, len(sc.Files))
+	for _, e := range sc.Files {
+		keys[e.Path] = e.key()
+	}
+
+	out := make(map[string]baselineEntry, len(m.Files))
+	for _, fe := range m.Files {
+		if fe.Type != manifest.TypeFile {
+			continue
+		}
+		k, ok := keys[fe.Path]
+		if !ok || k.Size != fe.SizeBytes {
+			continue
+		}
+		all := entryDigests(fe)
+		d := make(hashing.Digests, len(algs))
+		for _, alg := range algs {
+			if sum, ok := all[alg]; ok {
+				d[alg] = sum
+			}
+		}
+		if len(d) != len(algs) {
+			continue
+		}
+		out[fe.Path] = baselineEntry{key: k, size: fe.SizeBytes, digests: d}
+	}
+	return out, nil
+}
+
+func writeStatCache(outDir, tool string, entries []statCacheEntry) error {
+	sc := statCache{Tool: tool, Files: entries}
+	if sc.Files == nil {
+		sc.Files = []statCacheEntry{}
+	}
+	b, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(outDir, statCacheName, append(b, '\n'))
+}
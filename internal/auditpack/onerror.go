@@ -0,0 +1,49 @@
+package auditpack
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrorPolicy decides what Build does when an input path cannot be read.
+type ErrorPolicy string
+
+const (
+	// ErrorsFail stops the build on the first unreadable path (the historical behavior).
+	ErrorsFail ErrorPolicy = "fail"
+	// ErrorsRecord lists unreadable paths under "errors" in manifest.json and
+	// marks the pack incomplete in run_meta.json instead of failing.
+	ErrorsRecord ErrorPolicy = "record"
+)
+
+// ParseErrorPolicy validates an --on-error value. Empty means ErrorsFail.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch p := ErrorPolicy(s); p {
+	case "":
+		return ErrorsFail, nil
+	case ErrorsFail, ErrorsRecord:
+		return p, nil
+	}
+	return "", usageErrorf("invalid error policy %q (want fail|record)", s)
+}
+
+// Error classes recorded in manifest.ErrorEntry.
+const (
+	ErrClassPermission = "permission_denied"
+	ErrClassNotFound   = "not_found"
+	ErrClassIO         = "io_error"
+	ErrClassUnstable   = "unstable" // kept changing while it was being hashed
+)
+
+// errorClass maps an input I/O or unstable-file error to its manifest error class.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrUnstable):
+		return ErrClassUnstable
+	case errors.Is(err, fs.ErrPermission):
+		return ErrClassPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrClassNotFound
+	}
+	return ErrClassIO
+}
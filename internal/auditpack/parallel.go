@@ -0,0 +1,95 @@
+package auditpack
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// effectiveJobs resolves a requested worker count: <= 0 means "one per CPU".
+func effectiveJobs(jobs int) int {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	return jobs
+}
+
+// parallelFor runs fn(i) for every i in [0, n) using at most jobs workers.
+//
+// Work is handed out in index order. After the first failure no new indices are
+// dispatched, and the error with the lowest index is returned, so the result is
+// the same regardless of worker count or scheduling order. Callers write results
+// into index-addressed slots, never into shared appends. Once ctx is done no new
+// indices are dispatched and ctx.Err() is returned.
+func parallelFor(ctx context.Context, n, jobs int, fn func(i int) error) error {
+	if n == 0 {
+		return nil
+	}
+	jobs = effectiveJobs(jobs)
+	if jobs > n {
+		jobs = n
+	}
+
+	if jobs == 1 {
+		for i := 0; i < n; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		mu       sync.Mutex
+		next     int
+		failed   bool
+		firstIdx = n
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	take := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed || next >= n || ctx.Err() != nil {
+			return 0, false
+		}
+		i := next
+		next++
+		return i, true
+	}
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := take()
+				if !ok {
+					return
+				}
+				if err := fn(i); err != nil {
+					mu.Lock()
+					failed = true
+					if i < firstIdx {
+						firstIdx = i
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
@@ -0,0 +1,106 @@
+package auditpack
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Progress is a snapshot passed to a ProgressFunc.
+type Progress struct {
+	Phase      string // "build" or "verify"
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+	Path       string // manifest path of the entry most recently started
+}
+
+// ProgressFunc receives progress snapshots. Calls are serialized, so the
+// function does not need its own locking, but it runs on hashing goroutines
+// and should return quickly.
+type ProgressFunc func(Progress)
+
+// progressEvery is how many bytes are hashed between byte-level reports.
+const progressEvery = 1 << 20
+
+// tracker aggregates progress from concurrent workers. A nil *tracker is a
+// valid no-op, so call sites do not need to check whether reporting is on.
+type tracker struct {
+	fn     ProgressFunc
+	mu     sync.Mutex
+	p      Progress
+	unsent int64
+}
+
+func newTracker(fn ProgressFunc, phase string, filesTotal int, bytesTotal int64) *tracker {
+	if fn == nil {
+		return nil
+	}
+	return &tracker{fn: fn, p: Progress{Phase: phase, FilesTotal: filesTotal, BytesTotal: bytesTotal}}
+}
+
+func (t *tracker) start(path string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.Path = path
+	t.emit()
+}
+
+func (t *tracker) add(n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.BytesDone += n
+	t.unsent += n
+	if t.unsent >= progressEvery {
+		t.emit()
+	}
+}
+
+// rewind takes back n bytes of a read that is about to be retried.
+func (t *tracker) rewind(n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.BytesDone -= n
+}
+
+func (t *tracker) done() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.p.FilesDone++
+	t.emit()
+}
+
+// emit must be called with t.mu held.
+func (t *tracker) emit() {
+	t.unsent = 0
+	t.fn(t.p)
+}
+
+// ctxReader stops a read loop once ctx is cancelled and reports bytes read.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+	t   *tracker
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	c.t.add(int64(n))
+	return n, err
+}
@@ -0,0 +1,107 @@
+package auditpack
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// Problem kinds in a VerifyReport.
+const (
+	ProblemMissing     = "missing"      // in the manifest, not in the input tree
+	ProblemModified    = "modified"     // digest or symlink target differs
+	ProblemSizeChanged = "size_changed" // size differs (so the content does too)
+	ProblemExtra       = "extra"        // in the input tree, not in the manifest (strict only)
+	ProblemUnreadable  = "unreadable"   // present but could not be stat'ed or read
+	ProblemTypeChanged = "type_changed" // e.g. a file became a directory or a symlink
+	ProblemAttrChanged = "attr_changed" // a captured attribute (mode, mtime, uid, gid) differs
+	ProblemUnsafePath  = "unsafe_path"  // reaching the path crosses a symlink or leaves the input root
+	ProblemUnstable    = "unstable"     // the file kept changing while it was being hashed
+)
+
+// Problem is one discrepancy between the input tree and manifest.json. Field
+// names what was compared ("sha256", "size_bytes", "target", "type", "mode",
+// ...) and Expected/Actual hold the two values as text, when there are any.
+type Problem struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Field    string `json:"field,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Message  string `json:"message"`
+
+	err error
+}
+
+// Err returns the problem as an *IntegrityError (the same error the
+// fail-fast VerifyInput returns for it).
+func (p Problem) Err() error { return p.err }
+
+func newProblem(path, kind, field, expected, actual string, err error) *Problem {
+	return &Problem{Path: path, Kind: kind, Field: field, Expected: expected, Actual: actual, Message: err.Error(),
+		err: &IntegrityError{Path: path, Kind: kind, Err: err}}
+}
+
+// VerifyReport lists every problem found by VerifyInputReport. Problems for
+// manifest entries come first, in path order, followed by strict-mode
+// problems (extra paths), also in path order, so the report is identical for
+// every Jobs value. In a Quick report, Rehashed counts the files whose size
+// or mtime differed and were therefore read; the rest were not. When the
+// check was restricted with VerifyOptions.Paths, Selected and SelectedBytes
+// give its coverage out of Entries and TotalBytes.
+type VerifyReport struct {
+	Input         string         `json:"input"`
+	Archive       string         `json:"archive,omitempty"`
+	Strict        bool           `json:"strict"`
+	FailFast      bool           `json:"fail_fast,omitempty"`
+	Quick         bool           `json:"quick,omitempty"`
+	Rehashed      int            `json:"rehashed,omitempty"`
+	Paths         []string       `json:"paths,omitempty"`
+	Entries       int            `json:"entries"`
+	Selected      int            `json:"selected,omitempty"`
+	TotalBytes    int64          `json:"total_bytes,omitempty"`
+	SelectedBytes int64          `json:"selected_bytes,omitempty"`
+	Incomplete    bool           `json:"incomplete,omitempty"`
+	OK            bool           `json:"ok"`
+	Counts        map[string]int `json:"counts,omitempty"`
+	Problems      []Problem      `json:"problems"`
+}
+
+func (r *VerifyReport) add(p *Problem) {
+	if p == nil {
+		return
+	}
+	r.Problems = append(r.Problems, *p)
+	if r.Counts == nil {
+		r.Counts = make(map[string]int)
+	}
+	r.Counts[p.Kind]++
+	r.OK = false
+}
+
+// Err returns the first problem as an error, or nil if there are none.
+func (r *VerifyReport) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return r.Problems[0].Err()
+}
+
+// WriteJSON writes the report to path as indented JSON. The output depends
+// only on the report contents.
+func (r *VerifyReport) WriteJSON(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Dir(path), filepath.Base(path), append(b, '\n'))
+}
+
+// typeName names a manifest entry type for Problem.Expected/Actual.
+func typeName(t string) string {
+	if t == manifest.TypeFile {
+		return "file"
+	}
+	return t
+}
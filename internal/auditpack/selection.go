@@ -0,0 +1,62 @@
+package auditpack
+
+import (
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/pathfilter"
+)
+
+// pathSelection restricts VerifyInput to the manifest entries matching
+// VerifyOptions.Paths. A nil selection selects everything.
+type pathSelection struct {
+	patterns []string
+	filters  []*pathfilter.Filter // one per pattern, to report unmatched ones
+}
+
+func newPathSelection(patterns []string) (*pathSelection, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	s := &pathSelection{patterns: patterns}
+	for _, p := range patterns {
+		f, err := pathfilter.New([]string{p}, nil, nil)
+		if err != nil {
+			return nil, usageErrorf("path selection: %w", err)
+		}
+		s.filters = append(s.filters, f)
+	}
+	return s, nil
+}
+
+// selects reports whether rel, or one of its ancestors, matches a pattern.
+func (s *pathSelection) selects(rel string) bool {
+	if s == nil {
+		return true
+	}
+	for _, f := range s.filters {
+		if f.Includes(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmatched returns the first pattern that selects none of paths, or "".
+// A pattern that matches nothing is almost always a typo, and silently
+// verifying nothing would look like success.
+func (s *pathSelection) unmatched(paths []string) string {
+	if s == nil {
+		return ""
+	}
+	for i, f := range s.filters {
+		hit := false
+		for _, p := range paths {
+			if f.Includes(p) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			return s.patterns[i]
+		}
+	}
+	return ""
+}
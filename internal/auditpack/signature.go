@@ -0,0 +1,133 @@
+package auditpack
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+// SignatureFile is the detached Ed25519 signature over manifest.sha256.
+// Because manifest.sha256 covers manifest.json and run_meta.json, a valid
+// signature seals the whole pack.
+const SignatureFile = "manifest.sha256.sig"
+
+// Integrity error kinds for signatures.
+const (
+	KindSignatureMissing = "signature_missing"
+	KindSignatureInvalid = "signature_invalid"
+)
+
+// SignPack checks the pack with VerifyPackContext and writes SignatureFile,
+// signing the exact bytes of manifest.sha256 with key. An existing signature
+// is never replaced: signing a signed pack fails with fs.ErrExist (further
+// signers use AddSignOff).
+func SignPack(ctx context.Context, outDir string, key ed25519.PrivateKey) error {
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return err
+	}
+	msg, err := readSignedChecksums(outDir)
+	if err != nil {
+		return err
+	}
+	err = writeFileExclusive(outDir, SignatureFile, signing.EncodeSignature(ed25519.Sign(key, msg)))
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("pack is already signed (%s exists; remove it to sign again, or add a sign-off): %w", SignatureFile, err)
+	}
+	return err
+}
+
+// VerifyPackSignature checks the pack with VerifyPackContext, then
+// SignatureFile against manifest.sha256 with pub.
+func VerifyPackSignature(ctx context.Context, outDir string, pub ed25519.PublicKey) (err error) {
+	defer func() { err = asIntegrity(err) }()
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return err
+	}
+	msg, err := readSignedChecksums(outDir)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, SignatureFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &IntegrityError{Path: SignatureFile, Kind: KindSignatureMissing,
+			Err: fmt.Errorf("pack is not signed: %s not found", SignatureFile)}
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", SignatureFile, err)
+	}
+	sig, err := signing.DecodeSignature(b)
+	if err != nil {
+		return &IntegrityError{Path: SignatureFile, Kind: KindSignatureInvalid, Err: fmt.Errorf("%s: %w", SignatureFile, err)}
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		return &IntegrityError{Path: SignatureFile, Kind: KindSignatureInvalid,
+			Err: fmt.Errorf("%s: signature does not match manifest.sha256 for this public key", SignatureFile)}
+	}
+	return nil
+}
+
+// readSignedChecksums returns manifest.sha256, the file pack signatures cover.
+func readSignedChecksums(outDir string) ([]byte, error) {
+	name := checksumFileName(hashing.SHA256)
+	b, err := os.ReadFile(filepath.Join(outDir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("pack has no %s to sign or verify (build it with the sha256 digest)", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// signedPayloads returns the pack files that signatures cover:
+// manifest.sha256 and AttestationFile, each nil when absent.
+func signedPayloads(outDir string) (sums, statement []byte) {
+	sums, _ = os.ReadFile(filepath.Join(outDir, checksumFileName(hashing.SHA256)))
+	statement, _ = os.ReadFile(filepath.Join(outDir, AttestationFile))
+	return sums, statement
+}
+
+// removeStaleSignatures removes the signatures a rebuild has invalidated:
+// every signature over manifest.sha256 when it differs from oldSums, and the
+// DSSE envelope over the attestation when that differs from oldStatement. It
+// returns the pack-relative names it removed. Only *.json sign-offs are
+// removed from SignaturesDir, and the directory itself only once empty.
+func removeStaleSignatures(outDir string, oldSums, oldStatement []byte) ([]string, error) {
+	sums, statement := signedPayloads(outDir)
+	var stale []string
+	if sums == nil || !bytes.Equal(sums, oldSums) {
+		stale = append(stale, SignatureFile, SSHSignatureFile, DSSEManifestFile)
+		offs, err := filepath.Glob(filepath.Join(outDir, SignaturesDir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range offs {
+			stale = append(stale, SignaturesDir+"/"+filepath.Base(p))
+		}
+	}
+	if statement == nil || !bytes.Equal(statement, oldStatement) {
+		stale = append(stale, DSSEAttestationFile)
+	}
+
+	var removed []string
+	for _, name := range stale {
+		err := os.Remove(filepath.Join(outDir, filepath.FromSlash(name)))
+		switch {
+		case err == nil:
+			removed = append(removed, name)
+		case !errors.Is(err, fs.ErrNotExist):
+			return removed, err
+		}
+	}
+	// Fails, harmlessly, while anything else is left in the directory.
+	_ = os.Remove(filepath.Join(outDir, SignaturesDir))
+	return removed, nil
+}
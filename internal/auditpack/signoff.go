@@ -0,0 +1,252 @@
+package auditpack
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+// SignaturesDir holds sign-off signatures, one file per signer, so several
+// people (say a preparer and a reviewer) can each sign the same pack.
+const SignaturesDir = "signatures"
+
+// KindSignatureThreshold reports too few valid trusted sign-offs.
+const KindSignatureThreshold = "signature_threshold"
+
+// signOffVersion is the version of the SignOff file format.
+const signOffVersion = 1
+
+// SignOff is one file in SignaturesDir: an Ed25519 signature over the exact
+// bytes of manifest.sha256, with the key that made it.
+type SignOff struct {
+	Version        int    `json:"version"`
+	Algorithm      string `json:"algorithm"`
+	KeyID          string `json:"key_id"`
+	PublicKey      string `json:"public_key"`      // PKIX PEM
+	ManifestSHA256 string `json:"manifest_sha256"` // hex SHA-256 of the signed manifest.sha256
+	Signature      string `json:"signature"`       // base64
+}
+
+// AddSignOff checks the pack with VerifyPackContext and adds key's signature
+// to SignaturesDir as <key id>.json. Existing signatures are never touched;
+// a second sign-off by the same key fails with fs.ErrExist. It returns the
+// pack-relative path of the new file.
+func AddSignOff(ctx context.Context, outDir string, key ed25519.PrivateKey) (string, error) {
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return "", err
+	}
+	msg, err := readSignedChecksums(outDir)
+	if err != nil {
+		return "", err
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	id, err := signing.KeyID(pub)
+	if err != nil {
+		return "", err
+	}
+	pubPEM, err := signing.MarshalPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(msg)
+	b, err := json.MarshalIndent(SignOff{
+		Version:        signOffVersion,
+		Algorithm:      "ed25519",
+		KeyID:          id,
+		PublicKey:      string(pubPEM),
+		ManifestSHA256: hex.EncodeToString(sum[:]),
+		Signature:      base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg)),
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := id + ".json"
+	rel := SignaturesDir + "/" + name
+	err = writeFileExclusive(filepath.Join(outDir, SignaturesDir), name, append(b, '\n'))
+	if errors.Is(err, fs.ErrExist) {
+		return "", fmt.Errorf("%s: pack is already signed off by key %s: %w", rel, id, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return rel, nil
+}
+
+// TrustedKey is one entry of a trusted keys file:
+//
+//	{"keys": [{"name": "preparer", "public_key": "-----BEGIN PUBLIC KEY-----\n..."}]}
+//
+// public_key is a PKIX PEM Ed25519 key (auditpack keygen's .pub file), or
+// just its base64 body on one line.
+type TrustedKey struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+type trustedKeysFile struct {
+	Keys []TrustedKey `json:"keys"`
+}
+
+// ParseTrustedKeys decodes a trusted keys file, returning the signer name
+// for each key id.
+func ParseTrustedKeys(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var f trustedKeysFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, usageErrorf("trusted keys: %w", err)
+	}
+	if len(f.Keys) == 0 {
+		return nil, usageErrorf("trusted keys: no keys listed")
+	}
+	names := make(map[string]string, len(f.Keys))
+	for i, k := range f.Keys {
+		if k.Name == "" {
+			return nil, usageErrorf("trusted keys: key %d has no name", i+1)
+		}
+		text := strings.TrimSpace(k.PublicKey)
+		if !strings.HasPrefix(text, "-----BEGIN") {
+			text = "-----BEGIN " + signing.PublicKeyPEMType + "-----\n" + text + "\n-----END " + signing.PublicKeyPEMType + "-----\n"
+		}
+		pub, err := signing.ParseEd25519PublicKey([]byte(text))
+		if err != nil {
+			return nil, usageErrorf("trusted keys: %s: %w", k.Name, err)
+		}
+		id, err := signing.KeyID(pub)
+		if err != nil {
+			return nil, err
+		}
+		if prev, dup := names[id]; dup {
+			return nil, usageErrorf("trusted keys: %s and %s are the same key", prev, k.Name)
+		}
+		names[id] = k.Name
+	}
+	return names, nil
+}
+
+// SignerStatus is the result for one file in SignaturesDir.
+type SignerStatus struct {
+	File    string `json:"file"`
+	KeyID   string `json:"key_id,omitempty"`
+	Name    string `json:"name,omitempty"` // from the trusted keys; empty if untrusted
+	Trusted bool   `json:"trusted"`
+	Valid   bool   `json:"valid"`
+	Reason  string `json:"reason,omitempty"` // why Valid is false
+}
+
+// SignOffReport is the outcome of VerifySignOffs.
+type SignOffReport struct {
+	ManifestSHA256 string         `json:"manifest_sha256"`
+	Required       int            `json:"required"`
+	Satisfied      int            `json:"satisfied"` // distinct trusted keys with a valid signature
+	Signers        []SignerStatus `json:"signers"`
+}
+
+// VerifySignOffs checks every signature in SignaturesDir against the current
+// manifest.sha256 and requires valid signatures from at least require
+// distinct keys in trusted (key id -> name, from ParseTrustedKeys). Invalid
+// and untrusted signatures are reported but only fail the check by leaving
+// the threshold unmet. The pack itself is checked first with
+// VerifyPackContext.
+func VerifySignOffs(ctx context.Context, outDir string, trusted map[string]string, require int) (rep *SignOffReport, err error) {
+	defer func() { err = asIntegrity(err) }()
+	if require < 1 {
+		return nil, usageErrorf("required signatures must be at least 1, got %d", require)
+	}
+	if require > len(trusted) {
+		return nil, usageErrorf("%d signatures required but only %d trusted keys listed", require, len(trusted))
+	}
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return nil, err
+	}
+	msg, err := readSignedChecksums(outDir)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(msg)
+	rep = &SignOffReport{ManifestSHA256: hex.EncodeToString(sum[:]), Required: require, Signers: []SignerStatus{}}
+
+	entries, err := os.ReadDir(filepath.Join(outDir, SignaturesDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read %s: %w", SignaturesDir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	counted := map[string]bool{}
+	for _, e := range entries {
+		st := checkSignOff(outDir, e, msg, rep.ManifestSHA256)
+		if name, ok := trusted[st.KeyID]; ok {
+			st.Name, st.Trusted = name, true
+		}
+		if st.Valid && st.Trusted && !counted[st.KeyID] {
+			counted[st.KeyID] = true
+			rep.Satisfied++
+		}
+		rep.Signers = append(rep.Signers, st)
+	}
+
+	if rep.Satisfied < require {
+		return rep, &IntegrityError{Path: SignaturesDir, Kind: KindSignatureThreshold,
+			Err: fmt.Errorf("sign-off incomplete: %d of %d required trusted keys signed manifest.sha256", rep.Satisfied, require)}
+	}
+	return rep, nil
+}
+
+// checkSignOff checks one SignaturesDir entry against manifest.sha256 (msg,
+// whose hex SHA-256 is digest).
+func checkSignOff(outDir string, e fs.DirEntry, msg []byte, digest string) SignerStatus {
+	st := SignerStatus{File: SignaturesDir + "/" + e.Name()}
+	if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".json") {
+		st.Reason = "not a signature file"
+		return st
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, SignaturesDir, e.Name()))
+	if err != nil {
+		st.Reason = err.Error()
+		return st
+	}
+	var so SignOff
+	if err := json.Unmarshal(b, &so); err != nil {
+		st.Reason = fmt.Sprintf("invalid JSON: %v", err)
+		return st
+	}
+	if so.Version != signOffVersion || so.Algorithm != "ed25519" {
+		st.Reason = fmt.Sprintf("unsupported version %d / algorithm %q", so.Version, so.Algorithm)
+		return st
+	}
+	pub, err := signing.ParseEd25519PublicKey([]byte(so.PublicKey))
+	if err != nil {
+		st.Reason = err.Error()
+		return st
+	}
+	if st.KeyID, err = signing.KeyID(pub); err != nil {
+		st.Reason = err.Error()
+		return st
+	}
+	sig, err := base64.StdEncoding.DecodeString(so.Signature)
+	switch {
+	case so.KeyID != st.KeyID:
+		st.Reason = "key_id does not match public_key"
+	case so.ManifestSHA256 != digest:
+		st.Reason = "signed a different manifest.sha256 (the pack changed after signing)"
+	case err != nil:
+		st.Reason = "signature is not base64"
+	case !ed25519.Verify(pub, msg, sig):
+		st.Reason = "signature does not match manifest.sha256"
+	default:
+		st.Valid = true
+	}
+	return st
+}
@@ -0,0 +1,45 @@
+package auditpack
+
+import (
+	"io/fs"
+)
+
+// SpecialPolicy decides what Build does with non-regular, non-symlink entries
+// (sockets, FIFOs, device nodes, ...). None of these are ever hashed.
+type SpecialPolicy string
+
+const (
+	// SpecialSkip leaves special files out of the manifest; only
+	// summary.skipped_count shows how many there were.
+	SpecialSkip SpecialPolicy = "skip"
+	// SpecialRecord also lists them under "skipped" in manifest.json.
+	SpecialRecord SpecialPolicy = "record"
+	// SpecialError fails the build on the first special file.
+	SpecialError SpecialPolicy = "error"
+)
+
+// ParseSpecialPolicy validates an --on-special value. Empty means SpecialSkip.
+func ParseSpecialPolicy(s string) (SpecialPolicy, error) {
+	switch p := SpecialPolicy(s); p {
+	case "":
+		return SpecialSkip, nil
+	case SpecialSkip, SpecialRecord, SpecialError:
+		return p, nil
+	}
+	return "", usageErrorf("invalid special-file policy %q (want skip|record|error)", s)
+}
+
+// specialKind names the kind of a non-regular file for manifest.SkippedEntry.
+func specialKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&fs.ModeCharDevice != 0:
+		return "char_device"
+	case mode&fs.ModeDevice != 0:
+		return "block_device"
+	}
+	return "irregular"
+}
@@ -0,0 +1,84 @@
+package auditpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+// SSHSignatureFile is an OpenSSH SSHSIG signature over manifest.sha256. It
+// can be checked without auditpack:
+//
+//	ssh-keygen -Y verify -f allowed_signers -I <identity> -n auditpack \
+//	    -s manifest.sha256.sshsig < manifest.sha256
+const SSHSignatureFile = "manifest.sha256.sshsig"
+
+// SSHNamespace is the SSHSIG namespace of pack signatures, so they cannot be
+// mistaken for (or replayed as) git or file signatures by the same key.
+const SSHNamespace = "auditpack"
+
+// SignPackSSH checks the pack with VerifyPackContext and writes
+// SSHSignatureFile, signing manifest.sha256 with s. An existing SSH signature
+// is never replaced: the call fails with an error wrapping fs.ErrExist.
+func SignPackSSH(ctx context.Context, outDir string, s signing.SSHSigner) error {
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return err
+	}
+	msg, err := readSignedChecksums(outDir)
+	if err != nil {
+		return err
+	}
+	armored, err := signing.SSHSign(s, SSHNamespace, msg)
+	if err != nil {
+		return fmt.Errorf("sign %s: %w", SSHSignatureFile, err)
+	}
+	err = writeFileExclusive(outDir, SSHSignatureFile, armored)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("pack is already SSH-signed (%s exists; remove it to sign again): %w", SSHSignatureFile, err)
+	}
+	return err
+}
+
+// VerifyPackSSH checks the pack with VerifyPackContext, then SSHSignatureFile
+// against manifest.sha256, and requires its key to be allowed for identity in
+// the auditpack namespace by signers, as ssh-keygen -Y verify does. It
+// returns the signer's key fingerprint.
+func VerifyPackSSH(ctx context.Context, outDir string, signers []signing.AllowedSigner, identity string) (fingerprint string, err error) {
+	defer func() { err = asIntegrity(err) }()
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return "", err
+	}
+	msg, err := readSignedChecksums(outDir)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, SSHSignatureFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", &IntegrityError{Path: SSHSignatureFile, Kind: KindSignatureMissing,
+			Err: fmt.Errorf("pack is not SSH-signed: %s not found", SSHSignatureFile)}
+	}
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", SSHSignatureFile, err)
+	}
+	invalid := func(err error) error {
+		return &IntegrityError{Path: SSHSignatureFile, Kind: KindSignatureInvalid, Err: fmt.Errorf("%s: %w", SSHSignatureFile, err)}
+	}
+	sig, err := signing.ParseSSHSignature(b)
+	if err != nil {
+		return "", invalid(err)
+	}
+	fingerprint = signing.SSHFingerprint(sig.PublicKey)
+	if err := sig.Verify(SSHNamespace, msg); err != nil {
+		return fingerprint, invalid(err)
+	}
+	if err := signing.Authorize(signers, identity, SSHNamespace, sig.PublicKey, time.Now()); err != nil {
+		return fingerprint, invalid(err)
+	}
+	return fingerprint, nil
+}
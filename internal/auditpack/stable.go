@@ -0,0 +1,121 @@
+package auditpack
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+)
+
+// RetryPolicy says how often a file that changed while it was being hashed
+// is read again before it is reported as unstable.
+type RetryPolicy struct {
+	Retries int           // reads after the first; 0 gives up at once
+	Delay   time.Duration // wait before the first retry, doubled for each further one
+}
+
+// DefaultRetryPolicy is the policy used by DefaultOptions, DefaultVerifyOptions
+// and the CLI.
+var DefaultRetryPolicy = RetryPolicy{Retries: 2, Delay: 100 * time.Millisecond}
+
+// fileState is what must not change while a file is read for its digest to
+// describe a real state of the file. ctime is zero where fileStatKey is
+// unavailable.
+type fileState struct {
+	size    int64
+	mtimeNS int64
+	ctimeNS int64
+}
+
+func stateOf(info fs.FileInfo) fileState {
+	s := fileState{size: info.Size(), mtimeNS: info.ModTime().UnixNano()}
+	if k, ok := fileStatKey(info); ok {
+		s.ctimeNS = k.CTimeNS
+	}
+	return s
+}
+
+// changed names the first field that differs between a and b, or "".
+func (a fileState) changed(b fileState) string {
+	switch {
+	case a.size != b.size:
+		return "size"
+	case a.mtimeNS != b.mtimeNS:
+		return "mtime"
+	case a.ctimeNS != b.ctimeNS:
+		return "ctime"
+	}
+	return ""
+}
+
+// errFileSwapped reports that the file opened for hashing is not the one
+// whose path was checked, i.e. the path was replaced (by a symlink, say) in
+// between.
+var errFileSwapped = errors.New("file was replaced after its path was checked")
+
+// hashFileStable is hashFile with stat-before/stat-after detection on the
+// open file: if its size, mtime or ctime moved during the read, or fewer or
+// more bytes were read than it holds, the read is retried per policy and an
+// *UnstableError for rel (the file's manifest path) is returned once the
+// retries are used up. info is the file's state during the read that
+// succeeded. If checked is set (the caller's Lstat of path), the opened file
+// must be that same file, or errFileSwapped is returned.
+func hashFileStable(ctx context.Context, path, rel string, checked fs.FileInfo, algs []string, t *tracker, policy RetryPolicy) (d hashing.Digests, n int64, info fs.FileInfo, err error) {
+	delay := policy.Delay
+	for attempt := 1; ; attempt++ {
+		var field string
+		d, n, info, field, err = hashFileOnce(ctx, path, checked, algs, t)
+		if err != nil || field == "" {
+			return d, n, info, err
+		}
+		t.rewind(n)
+		if attempt > policy.Retries {
+			return nil, 0, nil, &UnstableError{Path: rel, Field: field, Attempts: attempt}
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, 0, nil, ctx.Err()
+			case <-timer.C:
+			}
+			delay *= 2
+		}
+	}
+}
+
+func hashFileOnce(ctx context.Context, path string, checked fs.FileInfo, algs []string, t *tracker) (hashing.Digests, int64, fs.FileInfo, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, nil, "", err
+	}
+	defer f.Close()
+	before, err := f.Stat()
+	if err != nil {
+		return nil, 0, nil, "", err
+	}
+	// os.Open follows symlinks, so compare what was opened with what was
+	// checked rather than trusting the path.
+	if checked != nil && !os.SameFile(checked, before) {
+		return nil, 0, nil, "", errFileSwapped
+	}
+	d, n, err := hashing.HashReader(&ctxReader{ctx: ctx, r: f, t: t}, algs)
+	if err != nil {
+		return nil, 0, nil, "", err
+	}
+	after, err := f.Stat()
+	if err != nil {
+		return nil, 0, nil, "", err
+	}
+	if field := stateOf(before).changed(stateOf(after)); field != "" {
+		return nil, n, nil, field, nil
+	}
+	if n != after.Size() {
+		return nil, n, nil, "size", nil
+	}
+	return d, n, after, "", nil
+}
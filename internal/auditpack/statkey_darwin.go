@@ -0,0 +1,20 @@
+package auditpack
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func fileStatKey(info fs.FileInfo) (statKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return statKey{}, false
+	}
+	return statKey{
+		Size:    info.Size(),
+		MTimeNS: info.ModTime().UnixNano(),
+		CTimeNS: st.Ctimespec.Nano(),
+		Inode:   uint64(st.Ino),
+		Dev:     uint64(st.Dev),
+	}, true
+}
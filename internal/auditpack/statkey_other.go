@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package auditpack
+
+import "io/fs"
+
+// fileStatKey is unavailable here: without an inode and ctime a baseline
+// cannot prove a file is unchanged, so every file is re-hashed.
+func fileStatKey(info fs.FileInfo) (statKey, bool) {
+	return statKey{}, false
+}
@@ -0,0 +1,120 @@
+package auditpack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+)
+
+// packDocuments are the files every pack checksum file must cover.
+var packDocuments = []string{"manifest.json", "run_meta.json"}
+
+// VerifyPackStrict is VerifyPackContext plus checks on the pack directory
+// itself: it must hold exactly manifest.json, run_meta.json and one checksum
+// file per digest algorithm recorded in run_meta.json (stat_cache.json, the
+// attestation, the signature files and a signatures/ directory of *.json
+// sign-offs are allowed too), every checksum file must cover both JSON
+// documents, and stat_cache.json when there is one, exactly once, and no
+// *.tmp-* file from an interrupted write may be left behind.
+func VerifyPackStrict(ctx context.Context, outDir string) (err error) {
+	defer func() { err = asIntegrity(err) }()
+	if err := VerifyPackContext(ctx, outDir); err != nil {
+		return err
+	}
+	meta, err := readRunMeta(outDir)
+	if err != nil {
+		return err
+	}
+	algs := meta.Digests
+	if len(algs) == 0 {
+		algs = []string{hashing.SHA256}
+	}
+
+	want := make(map[string]bool, len(packDocuments)+len(algs))
+	for _, name := range packDocuments {
+		want[name] = true
+	}
+	for _, alg := range algs {
+		want[checksumFileName(alg)] = true
+	}
+	optional := map[string]bool{
+		statCacheName: true, AttestationFile: true,
+		SignatureFile: true, SSHSignatureFile: true, DSSEManifestFile: true, DSSEAttestationFile: true,
+	}
+
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		return fmt.Errorf("read pack directory: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if tmp, _ := filepath.Match("*.tmp-*", name); tmp {
+			return fmt.Errorf("strict-pack: stray temp file from an interrupted write: %s", name)
+		}
+	}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case e.IsDir() && name == SignaturesDir:
+			if err := checkSignaturesDir(outDir); err != nil {
+				return err
+			}
+			continue
+		case e.IsDir():
+			return fmt.Errorf("strict-pack: unexpected directory in pack: %s", name)
+		case !e.Type().IsRegular():
+			return fmt.Errorf("strict-pack: not a regular file: %s", name)
+		case !want[name] && !optional[name]:
+			return fmt.Errorf("strict-pack: unexpected file in pack: %s", name)
+		}
+	}
+	mustCover := packDocuments
+	if _, err := os.Lstat(filepath.Join(outDir, statCacheName)); err == nil {
+		mustCover = append(append([]string(nil), packDocuments...), statCacheName)
+	}
+	for _, alg := range algs {
+		name := checksumFileName(alg)
+		covered, err := verifyChecksumFile(outDir, alg)
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(covered))
+		for _, f := range covered {
+			if !contains(mustCover, f) {
+				return fmt.Errorf("strict-pack: %s covers unexpected file %q", name, f)
+			}
+			if seen[f] {
+				return fmt.Errorf("strict-pack: %s lists %s more than once", name, f)
+			}
+			seen[f] = true
+		}
+		for _, doc := range mustCover {
+			if !seen[doc] {
+				return fmt.Errorf("strict-pack: %s does not cover %s", name, doc)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSignaturesDir requires SignaturesDir to hold only regular *.json
+// files.
+func checkSignaturesDir(outDir string) error {
+	entries, err := os.ReadDir(filepath.Join(outDir, SignaturesDir))
+	if err != nil {
+		return fmt.Errorf("read %s: %w", SignaturesDir, err)
+	}
+	for _, e := range entries {
+		rel := SignaturesDir + "/" + e.Name()
+		if tmp, _ := filepath.Match("*.tmp-*", e.Name()); tmp {
+			return fmt.Errorf("strict-pack: stray temp file from an interrupted write: %s", rel)
+		}
+		if !e.Type().IsRegular() || filepath.Ext(e.Name()) != ".json" {
+			return fmt.Errorf("strict-pack: unexpected entry in %s: %s", SignaturesDir, rel)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package auditpack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy decides what Build does with symbolic links in the input tree.
+type SymlinkPolicy string
+
+const (
+	// SymlinksSkip leaves symlinks out of the manifest (the historical behavior).
+	SymlinksSkip SymlinkPolicy = "skip"
+	// SymlinksRecord adds a "symlink" entry holding the link target text.
+	SymlinksRecord SymlinkPolicy = "record"
+	// SymlinksFollow hashes the file the link points to, refusing links that
+	// resolve outside the input root or to a directory.
+	SymlinksFollow SymlinkPolicy = "follow"
+	// SymlinksError fails the build on the first symlink.
+	SymlinksError SymlinkPolicy = "error"
+)
+
+// ParseSymlinkPolicy validates a --symlinks value. Empty means SymlinksSkip.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case "":
+		return SymlinksSkip, nil
+	case SymlinksSkip, SymlinksRecord, SymlinksFollow, SymlinksError:
+		return p, nil
+	}
+	return "", usageErrorf("invalid symlink policy %q (want skip|record|follow|error)", s)
+}
+
+// readLinkTarget returns the link text in slash form, as stored in manifest.json.
+func readLinkTarget(p string) (string, error) {
+	t, err := os.Readlink(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(t), nil
+}
+
+// resolveFollow resolves the symlink at p for SymlinksFollow. The fully resolved
+// target must be a regular file inside rootReal (the input root with its own
+// symlinks already evaluated); it is returned with its size.
+func resolveFollow(rootReal, p, rel string) (string, int64, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", 0, fmt.Errorf("follow symlink %q: %w", rel, err)
+	}
+	r, err := filepath.Rel(rootReal, resolved)
+	if err != nil {
+		return "", 0, fmt.Errorf("follow symlink %q: %w", rel, err)
+	}
+	r = filepath.ToSlash(r)
+	if r == ".." || strings.HasPrefix(r, "../") || filepath.IsAbs(r) {
+		return "", 0, policyErrorf(rel, "--symlinks=follow", "symlink escapes input root: %q", rel)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", 0, fmt.Errorf("follow symlink %q: %w", rel, err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", 0, policyErrorf(rel, "--symlinks=follow", "symlink does not point to a regular file: %q", rel)
+	}
+	return resolved, info.Size(), nil
+}
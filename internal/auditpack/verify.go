@@ -1,96 +1,466 @@
 package auditpack
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/checksums"
 	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
 	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/pathfilter"
 )
 
+// VerifyPack checks the pack checksum files, manifest.json invariants and
+// that run_meta.json agrees with manifest.json.
 func VerifyPack(outDir string) error {
-	shaPath := filepath.Join(outDir, "manifest.sha256")
-	lines, err := readLines(shaPath)
+	return VerifyPackContext(context.Background(), outDir)
+}
+
+// VerifyPackContext is VerifyPack with cancellation.
+func VerifyPackContext(ctx context.Context, outDir string) (err error) {
+	defer func() { err = asIntegrity(err) }()
+	algs, err := packChecksumAlgs(outDir)
+	if err != nil {
+		return err
+	}
+	for _, alg := range algs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := verifyChecksumFile(outDir, alg); err != nil {
+			return err
+		}
+	}
+
+	// Also validate manifest.json internal consistency.
+	m, err := VerifyManifestSummary(filepath.Join(outDir, "manifest.json"))
 	if err != nil {
-		return fmt.Errorf("read manifest.sha256: %w", err)
+		return err
+	}
+
+	// run_meta.json is covered by the checksums, but that only proves it was
+	// not changed after the pack was written; it must also describe the same
+	// run as manifest.json.
+	meta, err := readRunMeta(outDir)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return fmt.Errorf("read run_meta.json: not found in %s", outDir)
 	}
-	if len(lines) == 0 {
-		return fmt.Errorf("manifest.sha256 is empty: %s", shaPath)
+	if err := checkPackAlgs(algs, *meta); err != nil {
+		return err
 	}
+	return checkRunMeta(m, *meta)
+}
 
-	// Parse expected checksums.
+// checkPackAlgs requires a checksum file in the pack (algs, in canonical
+// order) for every digest run_meta.json records, so deleting manifest.sha512
+// from a sha256+sha512 pack, say, does not go unnoticed. Extra checksum files
+// are verified like the others and left to VerifyPackStrict.
+func checkPackAlgs(algs []string, meta manifest.RunMeta) error {
+	recorded := meta.Digests
+	if len(recorded) == 0 {
+		recorded = []string{hashing.SHA256}
+	}
+	for _, alg := range recorded {
+		if !contains(algs, alg) {
+			return fmt.Errorf("missing %s (run_meta.json records digest %s)", checksumFileName(alg), alg)
+		}
+	}
+	return nil
+}
+
+// checkRunMeta reports the first field on which run_meta.json disagrees with
+// manifest.json.
+func checkRunMeta(m manifest.Manifest, meta manifest.RunMeta) error {
+	if meta.Input != m.Input {
+		return fmt.Errorf("run_meta.json input %q does not match manifest.json input %q", meta.Input, m.Input)
+	}
+	if meta.Version != m.Version {
+		return fmt.Errorf("run_meta.json version %q does not match manifest.json version %q", meta.Version, m.Version)
+	}
+	counts := []struct {
+		name       string
+		meta, want int64
+	}{
+		{"file_count", int64(meta.Summary.FileCount), int64(m.Summary.FileCount)},
+		{"total_bytes", meta.Summary.TotalBytes, m.Summary.TotalBytes},
+		{"skipped_count", int64(meta.Summary.SkippedCount), int64(m.Summary.SkippedCount)},
+		{"dir_count", int64(meta.Summary.DirCount), int64(m.Summary.DirCount)},
+		{"symlink_count", int64(meta.Summary.SymlinkCount), int64(m.Summary.SymlinkCount)},
+		{"error_count", int64(meta.Summary.ErrorCount), int64(m.Summary.ErrorCount)},
+	}
+	for _, c := range counts {
+		if c.meta != c.want {
+			return fmt.Errorf("run_meta.json summary.%s %d does not match manifest.json summary.%s %d", c.name, c.meta, c.name, c.want)
+		}
+	}
+	// Only a record-mode build lists its special files; the others just
+	// count them.
+	if meta.OnSpecial == string(SpecialRecord) {
+		if m.Summary.SkippedCount != len(m.Skipped) {
+			return fmt.Errorf("summary.skipped_count mismatch: expected %d got %d", len(m.Skipped), m.Summary.SkippedCount)
+		}
+	} else if len(m.Skipped) > 0 {
+		return fmt.Errorf("manifest.json lists skipped paths but run_meta.json on_special is not %q", SpecialRecord)
+	}
+	if meta.Incomplete != (len(m.Errors) > 0) {
+		return fmt.Errorf("run_meta.json incomplete=%t does not match the %d unreadable path(s) listed in manifest.json", meta.Incomplete, len(m.Errors))
+	}
+	return nil
+}
+
+// decodeStrict parses a pack document, rejecting fields the manifest types do
+// not define and anything after the top-level value.
+func decodeStrict(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after top-level value")
+	}
+	return nil
+}
+
+// packChecksumAlgs lists the algorithms that have a checksum file
+// (manifest.<algorithm>) in the pack, in canonical order.
+func packChecksumAlgs(outDir string) ([]string, error) {
+	var out []string
+	for _, alg := range hashing.Names() {
+		_, err := os.Stat(filepath.Join(outDir, checksumFileName(alg)))
+		if err == nil {
+			out = append(out, alg)
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("stat %s: %w", checksumFileName(alg), err)
+		}
+	}
+	if len(out) == 0 {
+		return nil, &MissingChecksumError{Dir: outDir}
+	}
+	return out, nil
+}
+
+// verifyChecksumFile checks every line of manifest.<alg> against the pack
+// files and returns the file names it covers, in file order.
+func verifyChecksumFile(outDir, alg string) ([]string, error) {
+	name := checksumFileName(alg)
+	h, _ := hashing.Lookup(alg)
+
+	shaPath := filepath.Join(outDir, name)
+	f, err := os.Open(shaPath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	entries, err := checksums.Parse(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	// Parse expected checksums. Lines may come from sha256sum (text or
+	// binary mode, escaped names) or from a BSD-style "--tag" tool.
 	type exp struct {
 		hash string
 		file string
 	}
-	exps := make([]exp, 0, len(lines))
-	for _, ln := range lines {
-		ln = strings.TrimSpace(ln)
-		if ln == "" || strings.HasPrefix(ln, "#") {
-			continue
-		}
-		fields := strings.Fields(ln)
-		if len(fields) < 2 {
-			return fmt.Errorf("invalid manifest.sha256 line: %q", ln)
+	exps := make([]exp, 0, len(entries))
+	for _, e := range entries {
+		if e.Tag != "" && strings.ToLower(e.Tag) != alg {
+			return nil, fmt.Errorf("%s line for %q is tagged %s, not %s", name, e.Name, e.Tag, alg)
 		}
-		h := fields[0]
-		f := fields[1]
-		if !isSHA256Hex(h) {
-			return fmt.Errorf("invalid sha256: %q", h)
+		sum := strings.ToLower(e.Sum)
+		if !isHexLen(sum, h.HexLen()) {
+			return nil, fmt.Errorf("invalid %s: %q", alg, e.Sum)
 		}
-		if strings.Contains(f, "..") || strings.Contains(f, "\\") || strings.HasPrefix(f, "/") {
-			return fmt.Errorf("invalid filename in manifest.sha256: %q", f)
+		file := e.Name
+		if strings.Contains(file, "..") || strings.Contains(file, "\\") || strings.HasPrefix(file, "/") {
+			return nil, fmt.Errorf("invalid filename in %s: %q", name, file)
 		}
-		exps = append(exps, exp{hash: h, file: f})
+		exps = append(exps, exp{hash: sum, file: file})
 	}
 
 	if len(exps) == 0 {
-		return fmt.Errorf("no checksum entries found in manifest.sha256")
+		return nil, fmt.Errorf("no checksum entries found in %s", name)
 	}
 
 	// Verify each referenced file.
+	covered := make([]string, 0, len(exps))
 	for _, e := range exps {
 		p := filepath.Join(outDir, e.file)
-		got, err := hashing.SHA256File(p)
+		got, _, err := hashing.HashFile(p, []string{alg})
 		if err != nil {
-			return fmt.Errorf("hash %s: %w", e.file, err)
+			return nil, fmt.Errorf("hash %s: %w", e.file, err)
 		}
-		if got.SHA256 != e.hash {
-			return fmt.Errorf("sha256 mismatch for %s: expected %s got %s", e.file, e.hash, got.SHA256)
+		if got[alg] != e.hash {
+			return nil, &IntegrityError{Path: e.file, Kind: KindChecksumMismatch,
+				Err: fmt.Errorf("%s mismatch for %s: expected %s got %s", alg, e.file, e.hash, got[alg])}
 		}
+		covered = append(covered, e.file)
 	}
+	return covered, nil
+}
 
-	// Also validate manifest.json internal consistency.
-	_, err = VerifyManifestSummary(filepath.Join(outDir, "manifest.json"))
+// VerifyOptions controls VerifyInputWith.
+type VerifyOptions struct {
+	Strict bool // if true, fail on extra input files not listed in manifest.json
+	// Jobs bounds the number of files hashed concurrently. <= 0 means one
+	// worker per CPU. The reported problems are the same for every value.
+	Jobs int
+	// IgnoreAttrs lists captured metadata attributes (AttrMode, AttrMTime,
+	// AttrUID, AttrGID) not to enforce. Every other captured attribute is checked.
+	IgnoreAttrs []string
+	// Progress, if set, receives snapshots while input files are hashed.
+	Progress ProgressFunc
+	// FailFast stops at the first problem instead of collecting every one.
+	FailFast bool
+	// Quick compares each file's size (and mtime, when the pack captured it)
+	// with manifest.json instead of reading it, and re-hashes only the files
+	// where they differ. A file rewritten in place with the same size and
+	// mtime passes, so this is not cryptographic verification.
+	Quick bool
+	// Paths, if set, restricts the check to manifest entries matching one of
+	// these patterns (the --include syntax: a pattern also selects everything
+	// below a matching directory). Other entries are not checked and are not
+	// reported as missing; strict mode only reports extras among selected
+	// paths. Every pattern must select at least one manifest entry.
+	Paths []string
+	// Retry is how often a file that changed while it was being hashed is
+	// read again before it is reported as ProblemUnstable. The zero value
+	// reports it at once; DefaultVerifyOptions sets DefaultRetryPolicy.
+	Retry RetryPolicy
+}
+
+// DefaultVerifyOptions returns the options VerifyInput uses: a full,
+// non-strict check that retries files that change while they are hashed.
+func DefaultVerifyOptions() VerifyOptions {
+	return VerifyOptions{Retry: DefaultRetryPolicy}
+}
+
+// VerifyInput checks the input tree against manifest.json using default options.
+func VerifyInput(inDir, outDir string, strict bool) error {
+	opts := DefaultVerifyOptions()
+	opts.Strict = strict
+	return VerifyInputWith(inDir, outDir, opts)
+}
+
+// VerifyInputWith checks the input tree against manifest.json.
+func VerifyInputWith(inDir, outDir string, opts VerifyOptions) error {
+	return VerifyInputContext(context.Background(), inDir, outDir, opts)
+}
+
+// VerifyInputContext is VerifyInputWith with cancellation: once ctx is done no
+// new files are hashed, in-flight reads stop and ctx.Err() is returned.
+// Otherwise the error is the first problem VerifyInputReport finds.
+func VerifyInputContext(ctx context.Context, inDir, outDir string, opts VerifyOptions) error {
+	rep, err := VerifyInputReport(ctx, inDir, outDir, opts)
 	if err != nil {
 		return err
 	}
+	return rep.Err()
+}
+
+// VerifyInputReport checks the input tree against manifest.json and lists every
+// problem found, or only the first one when opts.FailFast is set. The error is
+// reserved for failures that prevent verification: an unreadable or invalid
+// manifest, an input tree that cannot be walked, or cancellation.
+func VerifyInputReport(ctx context.Context, inDir, outDir string, opts VerifyOptions) (_ *VerifyReport, err error) {
+	defer func() { err = asIntegrity(err) }()
+	c, err := prepareInputCheck(outDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	rep, sorted, expected := c.rep, c.sorted, c.expected
 
-	return nil
+	// Entries are resolved one component at a time and never through a
+	// symlink, except a final link in a pack built with --symlinks=follow.
+	root := inputRoot{dir: inDir}
+	if c.follow() {
+		root.follow = true
+		if root.real, err = filepath.EvalSymlinks(inDir); err != nil {
+			return nil, fmt.Errorf("resolve input root: %w", err)
+		}
+	}
+
+	// Verify actual input tree matches manifest entries. Files are hashed in
+	// parallel into per-path slots, so the report (and, with FailFast, the
+	// single problem reported) does not depend on scheduling.
+	problems := make([]*Problem, len(sorted))
+	hashed := make([]bool, len(sorted))
+	prog := newTracker(opts.Progress, "verify", len(sorted), c.checkBytes)
+	err = parallelFor(ctx, len(sorted), opts.Jobs, func(i int) error {
+		p := sorted[i]
+		prog.start(p)
+		defer prog.done()
+		pr, h, err := checkEntry(ctx, root, expected[p], opts, prog)
+		if err != nil {
+			return err
+		}
+		problems[i], hashed[i] = pr, h
+		if pr != nil && opts.FailFast {
+			return pr.err
+		}
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil && !opts.FailFast {
+		return nil, err
+	}
+	if opts.Quick {
+		for _, h := range hashed {
+			if h {
+				rep.Rehashed++
+			}
+		}
+	}
+	for _, pr := range problems {
+		rep.add(pr)
+		if pr != nil && opts.FailFast {
+			return rep, nil
+		}
+	}
+
+	if opts.Strict {
+		filter, scan, err := c.strictScan()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := walkInputTree(ctx, inDir, filter, scan)
+		if err != nil {
+			return nil, err
+		}
+		c.addExtras(actual, scan, opts.FailFast)
+	}
+	return rep, nil
 }
 
-func VerifyInput(inDir, outDir string, strict bool) error {
+// follow reports whether the pack was built with --symlinks=follow.
+func (c *inputCheck) follow() bool {
+	return c.meta != nil && c.meta.Symlinks == string(SymlinksFollow)
+}
+
+// strictScan returns the include/exclude/ignore patterns and symlink policy
+// the pack was built with, so filtered-out paths are not reported as extras.
+func (c *inputCheck) strictScan() (*pathfilter.Filter, inputScan, error) {
+	filter, err := metaFilter(c.meta)
+	if err != nil {
+		return nil, inputScan{}, err
+	}
+	scan := scanFromMeta(c.meta)
+	// Paths that could not be read at build time are not covered by the
+	// pack, so whatever is there now is neither missing nor extra.
+	for _, ee := range c.m.Errors {
+		if scan.unreadable == nil {
+			scan.unreadable = make(map[string]bool, len(c.m.Errors))
+		}
+		scan.unreadable[ee.Path] = true
+	}
+	return filter, scan, nil
+}
+
+// addExtras adds the strict-mode problems for actual, the selected paths
+// found in the input tree mapped to their kind: paths not in the manifest
+// and recorded special files that are gone or changed kind.
+func (c *inputCheck) addExtras(actual map[string]string, scan inputScan, failFast bool) {
+	skipped := make(map[string]string, len(c.m.Skipped))
+	for _, se := range c.m.Skipped {
+		skipped[se.Path] = se.Kind
+	}
+
+	extras := make([]string, 0)
+	for ap := range actual {
+		extras = append(extras, ap)
+	}
+	sort.Strings(extras)
+	for _, ap := range extras {
+		if !c.sel.selects(ap) {
+			continue
+		}
+		var pr *Problem
+		kind := actual[ap]
+		if !isSpecialKind(kind) {
+			if _, ok := c.expected[ap]; !ok {
+				if kind == manifest.TypeDir {
+					pr = newProblem(ap, ProblemExtra, "", "", typeName(kind),
+						fmt.Errorf("strict: extra input directory not in manifest: %q", ap))
+				} else {
+					pr = newProblem(ap, ProblemExtra, "", "", typeName(kind),
+						fmt.Errorf("strict: extra input file not in manifest: %q", ap))
+				}
+			}
+		} else if want, ok := skipped[ap]; !ok {
+			pr = newProblem(ap, ProblemExtra, "", "", kind,
+				fmt.Errorf("strict: extra special file not in manifest: %q (%s)", ap, kind))
+		} else if want != kind {
+			pr = newProblem(ap, ProblemTypeChanged, "type", want, kind,
+				fmt.Errorf("strict: special file kind changed for %q: expected %s got %s", ap, want, kind))
+		}
+		c.rep.add(pr)
+		if pr != nil && failFast {
+			return
+		}
+	}
+	if scan.special {
+		for _, se := range c.m.Skipped {
+			if _, ok := actual[se.Path]; !ok && c.sel.selects(se.Path) {
+				c.rep.add(newProblem(se.Path, ProblemMissing, "", se.Kind, "",
+					fmt.Errorf("strict: recorded special file missing: %q (%s)", se.Path, se.Kind)))
+				if failFast {
+					return
+				}
+			}
+		}
+	}
+}
+
+// inputCheck is a validated manifest.json (plus run_meta.json) prepared for
+// checking an input tree, on disk or in an archive, against it.
+type inputCheck struct {
+	m          manifest.Manifest
+	meta       *manifest.RunMeta
+	expected   map[string]manifest.FileEntry
+	sorted     []string // the selected manifest paths, in order
+	sel        *pathSelection
+	checkBytes int64 // total size of the selected entries
+	rep        *VerifyReport
+}
+
+// prepareInputCheck validates the pack's manifest.json and applies the path
+// selection in opts.
+func prepareInputCheck(outDir string, opts VerifyOptions) (*inputCheck, error) {
 	manPath := filepath.Join(outDir, "manifest.json")
 	b, err := os.ReadFile(manPath)
 	if err != nil {
-		return fmt.Errorf("read manifest.json: %w", err)
+		return nil, fmt.Errorf("read manifest.json: %w", err)
 	}
 
 	var m manifest.Manifest
-	if err := json.Unmarshal(b, &m); err != nil {
-		return fmt.Errorf("parse manifest.json: %w", err)
+	if err := decodeStrict(b, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest.json: %w", err)
 	}
 
 	if len(m.Files) == 0 {
-		return fmt.Errorf("manifest.json has no files")
+		return nil, fmt.Errorf("manifest.json has no files")
 	}
 
 	// Validate paths are unique + clean, and verify each file.
@@ -100,16 +470,16 @@ func VerifyInput(inDir, outDir string, strict bool) error {
 	var totalBytes int64
 	for _, fe := range m.Files {
 		if err := validateRelPath(fe.Path); err != nil {
-			return fmt.Errorf("manifest path invalid (%q): %w", fe.Path, err)
-		}
-		if !isSHA256Hex(fe.SHA256) {
-			return fmt.Errorf("manifest sha256 invalid for %q: %q", fe.Path, fe.SHA256)
+			return nil, fmt.Errorf("manifest path invalid (%q): %w", fe.Path, err)
 		}
 		if fe.SizeBytes < 0 {
-			return fmt.Errorf("manifest size invalid for %q: %d", fe.Path, fe.SizeBytes)
+			return nil, fmt.Errorf("manifest size invalid for %q: %d", fe.Path, fe.SizeBytes)
+		}
+		if err := validateEntryType(fe); err != nil {
+			return nil, err
 		}
 		if _, ok := expected[fe.Path]; ok {
-			return fmt.Errorf("duplicate manifest path: %q", fe.Path)
+			return nil, fmt.Errorf("duplicate manifest path: %q", fe.Path)
 		}
 		expected[fe.Path] = fe
 		paths = append(paths, fe.Path)
@@ -121,66 +491,240 @@ func VerifyInput(inDir, outDir string, strict bool) error {
 	sort.Strings(sorted)
 	for i := range paths {
 		if paths[i] != sorted[i] {
-			return fmt.Errorf("manifest files are not sorted by path (determinism invariant)")
+			return nil, fmt.Errorf("manifest files are not sorted by path (determinism invariant)")
 		}
 	}
 
 	// Summary invariant.
-	if m.Summary.FileCount != len(m.Files) {
-		return fmt.Errorf("summary.file_count mismatch: expected %d got %d", len(m.Files), m.Summary.FileCount)
-	}
 	if m.Summary.TotalBytes != totalBytes {
-		return fmt.Errorf("summary.total_bytes mismatch: expected %d got %d", totalBytes, m.Summary.TotalBytes)
+		return nil, fmt.Errorf("summary.total_bytes mismatch: expected %d got %d", totalBytes, m.Summary.TotalBytes)
+	}
+	if err := validateSkipped(m); err != nil {
+		return nil, err
+	}
+	if err := validateErrors(m); err != nil {
+		return nil, err
 	}
 
-	// Verify actual input tree matches manifest entries.
-	for _, p := range sorted {
-		fe := expected[p]
-		full := filepath.Join(inDir, filepath.FromSlash(p))
+	meta, err := readRunMeta(outDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sel, err := newPathSelection(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+	if p := sel.unmatched(sorted); p != "" {
+		return nil, usageErrorf("path pattern %q matches no manifest entry", p)
+	}
 
-		info, err := os.Stat(full)
+	rep := &VerifyReport{
+		Input:      m.Input,
+		Strict:     opts.Strict,
+		FailFast:   opts.FailFast,
+		Quick:      opts.Quick,
+		Entries:    len(m.Files),
+		Incomplete: len(m.Errors) > 0,
+		OK:         true,
+		Problems:   []Problem{},
+	}
+	checkBytes := m.Summary.TotalBytes
+	if sel != nil {
+		selected := sorted[:0:0]
+		checkBytes = 0
+		for _, p := range sorted {
+			if sel.selects(p) {
+				selected = append(selected, p)
+				checkBytes += expected[p].SizeBytes
+			}
+		}
+		sorted = selected
+		rep.Paths = opts.Paths
+		rep.Selected = len(selected)
+		rep.SelectedBytes = checkBytes
+		rep.TotalBytes = m.Summary.TotalBytes
+	}
+
+	return &inputCheck{m: m, meta: meta, expected: expected, sorted: sorted, sel: sel, checkBytes: checkBytes, rep: rep}, nil
+}
+
+// inputRoot is the input tree a pack is verified against.
+type inputRoot struct {
+	dir    string
+	follow bool   // the pack was built with --symlinks=follow
+	real   string // dir with symlinks resolved; set when follow is
+}
+
+// lstat resolves rel under the root one component at a time with Lstat. A
+// symlink anywhere on the way is an unsafe_path problem, except as the final
+// component when finalLink is set; the caller decides what to do with it.
+func (r inputRoot) lstat(fe manifest.FileEntry, finalLink bool, missingFormat string) (fs.FileInfo, *Problem) {
+	parts := strings.Split(fe.Path, "/")
+	cur := r.dir
+	var info fs.FileInfo
+	for i, part := range parts {
+		cur = filepath.Join(cur, part)
+		var err error
+		if info, err = os.Lstat(cur); err != nil {
+			return nil, statProblem(fe, err, missingFormat)
+		}
+		last := i == len(parts)-1
+		if info.Mode()&fs.ModeSymlink != 0 && !(last && finalLink) {
+			at := strings.Join(parts[:i+1], "/")
+			return nil, newProblem(fe.Path, ProblemUnsafePath, "", "", at,
+				fmt.Errorf("input path %q crosses a symlink at %q", fe.Path, at))
+		}
+		if !last && !info.IsDir() {
+			return nil, statProblem(fe, syscall.ENOTDIR, missingFormat)
+		}
+	}
+	return info, nil
+}
+
+// checkEntry compares one manifest entry with the input tree and reports
+// whether the entry's contents were hashed. The error is only set when ctx
+// was cancelled while the entry was being hashed.
+func checkEntry(ctx context.Context, root inputRoot, fe manifest.FileEntry, opts VerifyOptions, prog *tracker) (*Problem, bool, error) {
+	p := fe.Path
+	full := filepath.Join(root.dir, filepath.FromSlash(p))
+
+	if fe.Type == manifest.TypeDir {
+		info, pr := root.lstat(fe, false, "input missing directory %q: %w")
+		if pr != nil {
+			return pr, false, nil
+		}
+		if !info.IsDir() {
+			return newProblem(p, ProblemTypeChanged, "type", manifest.TypeDir, typeName(infoType(info)),
+				fmt.Errorf("input not a directory %q", p)), false, nil
+		}
+		return checkAttrs(fe, info, opts.IgnoreAttrs), false, nil
+	}
+
+	// Recorded symlinks are checked as links: never followed.
+	if fe.Type == manifest.TypeSymlink {
+		info, pr := root.lstat(fe, true, "input missing %q: %w")
+		if pr != nil {
+			return pr, false, nil
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return newProblem(p, ProblemTypeChanged, "type", manifest.TypeSymlink, typeName(infoType(info)),
+				fmt.Errorf("input not a symlink %q", p)), false, nil
+		}
+		target, err := readLinkTarget(full)
 		if err != nil {
-			return fmt.Errorf("input missing %q: %w", p, err)
+			return newProblem(p, ProblemUnreadable, "target", "", "", fmt.Errorf("read symlink %q: %w", p, pathCause(err))), false, nil
 		}
-		if !info.Mode().IsRegular() {
-			return fmt.Errorf("input not a regular file %q", p)
+		if target != fe.Target {
+			return newProblem(p, ProblemModified, "target", fe.Target, target,
+				fmt.Errorf("input symlink target mismatch for %q: expected %q got %q", p, fe.Target, target)), false, nil
 		}
+		return checkAttrs(fe, info, opts.IgnoreAttrs), false, nil
+	}
 
-		h, err := hashing.SHA256File(full)
+	info, pr := root.lstat(fe, root.follow, "input missing %q: %w")
+	if pr != nil {
+		return pr, false, nil
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		// Follow-mode pack: hash what the link points to, as Build did, as
+		// long as that stays inside the input root.
+		resolved, err := filepath.EvalSymlinks(full)
 		if err != nil {
-			return fmt.Errorf("hash input %q: %w", p, err)
+			return statProblem(fe, err, "input missing %q: %w"), false, nil
 		}
-		if h.SHA256 != fe.SHA256 {
-			return fmt.Errorf("input sha256 mismatch for %q: expected %s got %s", p, fe.SHA256, h.SHA256)
+		if r, err := filepath.Rel(root.real, resolved); err != nil || r == ".." || strings.HasPrefix(filepath.ToSlash(r), "../") || filepath.IsAbs(r) {
+			return newProblem(p, ProblemUnsafePath, "", "", "",
+				fmt.Errorf("input path %q resolves outside the input root", p)), false, nil
 		}
-		if h.SizeBytes != fe.SizeBytes {
-			return fmt.Errorf("input size mismatch for %q: expected %d got %d", p, fe.SizeBytes, h.SizeBytes)
+		if info, err = os.Lstat(resolved); err != nil {
+			return statProblem(fe, err, "input missing %q: %w"), false, nil
 		}
+		full = resolved
+	}
+	if !info.Mode().IsRegular() {
+		return newProblem(p, ProblemTypeChanged, "type", typeName(manifest.TypeFile), typeName(infoType(info)),
+			fmt.Errorf("input not a regular file %q", p)), false, nil
 	}
 
-	if strict {
-		actual, err := walkInputRegularFiles(inDir)
-		if err != nil {
-			return err
+	// Quick mode trusts an unchanged size and mtime; anything else is
+	// suspicious and is hashed like a full check.
+	if opts.Quick && info.Size() == fe.SizeBytes && (fe.MTime == "" || formatMTime(info.ModTime()) == fe.MTime) {
+		prog.add(fe.SizeBytes)
+		return checkAttrs(fe, info, opts.IgnoreAttrs), false, nil
+	}
+
+	// Check every algorithm the pack recorded, in one read.
+	want := entryDigests(fe)
+	got, n, _, err := hashFileStable(ctx, full, p, info, digestAlgs(want), prog, opts.Retry)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, true, ctxErr
 		}
-		for ap := range actual {
-			if _, ok := expected[ap]; !ok {
-				return fmt.Errorf("strict: extra input file not in manifest: %q", ap)
-			}
+		if errors.Is(err, errFileSwapped) {
+			return newProblem(p, ProblemUnsafePath, "", "", "",
+				fmt.Errorf("input path %q was replaced while it was being checked", p)), true, nil
+		}
+		var u *UnstableError
+		if errors.As(err, &u) {
+			return newProblem(p, ProblemUnstable, u.Field, "", "",
+				fmt.Errorf("input %q changed while it was being hashed (%s moved; %d attempts)", p, u.Field, u.Attempts)), true, nil
 		}
+		return newProblem(p, ProblemUnreadable, "", "", "", fmt.Errorf("hash input %q: %w", p, pathCause(err))), true, nil
+	}
+	if n != fe.SizeBytes {
+		return newProblem(p, ProblemSizeChanged, "size_bytes", strconv.FormatInt(fe.SizeBytes, 10), strconv.FormatInt(n, 10),
+			fmt.Errorf("input size mismatch for %q: expected %d got %d", p, fe.SizeBytes, n)), true, nil
+	}
+	if pr := compareDigests(p, want, got); pr != nil {
+		return pr, true, nil
 	}
+	return checkAttrs(fe, info, opts.IgnoreAttrs), true, nil
+}
 
-	return nil
+// statProblem classifies a failed stat of a manifest entry: gone (or a parent
+// is no longer a directory) is "missing", anything else "unreadable".
+func statProblem(fe manifest.FileEntry, err error, format string) *Problem {
+	err = pathCause(err)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return newProblem(fe.Path, ProblemMissing, "", typeName(fe.Type), "", fmt.Errorf(format, fe.Path, err))
+	}
+	return newProblem(fe.Path, ProblemUnreadable, "", "", "", fmt.Errorf("input unreadable %q: %w", fe.Path, err))
+}
+
+// pathCause strips the operation and absolute path from a *fs.PathError, so
+// problem messages (and reports) do not depend on where the input tree lives.
+func pathCause(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// infoType names what is at a path for a type_changed problem.
+func infoType(info fs.FileInfo) string {
+	switch mode := info.Mode(); {
+	case mode.IsRegular():
+		return manifest.TypeFile
+	case mode.IsDir():
+		return manifest.TypeDir
+	case mode&fs.ModeSymlink != 0:
+		return manifest.TypeSymlink
+	default:
+		return specialKind(mode.Type())
+	}
 }
 
 // VerifyManifestSummary validates manifest.json internal invariants (paths sorted/unique, summary counts/totals).
-func VerifyManifestSummary(manifestPath string) (manifest.Manifest, error) {
+func VerifyManifestSummary(manifestPath string) (_ manifest.Manifest, err error) {
+	defer func() { err = asIntegrity(err) }()
 	b, err := os.ReadFile(manifestPath)
 	if err != nil {
 		return manifest.Manifest{}, fmt.Errorf("read manifest.json: %w", err)
 	}
 	var m manifest.Manifest
-	if err := json.Unmarshal(b, &m); err != nil {
+	if err := decodeStrict(b, &m); err != nil {
 		return manifest.Manifest{}, fmt.Errorf("parse manifest.json: %w", err)
 	}
 	if len(m.Files) == 0 {
@@ -195,6 +739,9 @@ func VerifyManifestSummary(manifestPath string) (manifest.Manifest, error) {
 		if err := validateRelPath(fe.Path); err != nil {
 			return manifest.Manifest{}, fmt.Errorf("manifest path invalid (%q): %w", fe.Path, err)
 		}
+		if err := validateEntryType(fe); err != nil {
+			return manifest.Manifest{}, err
+		}
 		if seen[fe.Path] {
 			return manifest.Manifest{}, fmt.Errorf("duplicate manifest path: %q", fe.Path)
 		}
@@ -211,27 +758,133 @@ func VerifyManifestSummary(manifestPath string) (manifest.Manifest, error) {
 		}
 	}
 
-	if m.Summary.FileCount != len(m.Files) {
-		return manifest.Manifest{}, fmt.Errorf("summary.file_count mismatch: expected %d got %d", len(m.Files), m.Summary.FileCount)
-	}
 	if m.Summary.TotalBytes != totalBytes {
 		return manifest.Manifest{}, fmt.Errorf("summary.total_bytes mismatch: expected %d got %d", totalBytes, m.Summary.TotalBytes)
 	}
+	if err := validateSkipped(m); err != nil {
+		return manifest.Manifest{}, err
+	}
+	if err := validateErrors(m); err != nil {
+		return manifest.Manifest{}, err
+	}
 
 	return m, nil
 }
 
-func walkInputRegularFiles(inDir string) (map[string]struct{}, error) {
-	out := make(map[string]struct{}, 64)
+// validateEntryType checks the type-specific fields of a manifest entry.
+func validateEntryType(fe manifest.FileEntry) error {
+	switch fe.Type {
+	case manifest.TypeFile:
+		if err := validateDigests(fe); err != nil {
+			return err
+		}
+		if fe.Target != "" {
+			return fmt.Errorf("manifest entry %q: target set on a regular file", fe.Path)
+		}
+	case manifest.TypeDir:
+		if fe.SHA256 != "" || len(fe.Digests) > 0 || fe.SizeBytes != 0 || fe.Target != "" {
+			return fmt.Errorf("manifest entry %q: directory with size, digest or target", fe.Path)
+		}
+	case manifest.TypeSymlink:
+		if fe.Target == "" {
+			return fmt.Errorf("manifest entry %q: symlink without target", fe.Path)
+		}
+		if err := validateDigests(fe); err != nil {
+			return err
+		}
+		want := entryDigests(fe)
+		got, err := hashing.HashBytes([]byte(fe.Target), digestAlgs(want))
+		if err != nil {
+			return err
+		}
+		if compareDigests(fe.Path, want, got) != nil || int64(len(fe.Target)) != fe.SizeBytes {
+			return fmt.Errorf("manifest entry %q: symlink digest/size do not match target", fe.Path)
+		}
+	default:
+		return fmt.Errorf("manifest entry %q: unknown type %q", fe.Path, fe.Type)
+	}
+	if fe.Mode != "" {
+		if _, err := strconv.ParseUint(fe.Mode, 8, 32); err != nil {
+			return fmt.Errorf("manifest entry %q: invalid mode %q", fe.Path, fe.Mode)
+		}
+	}
+	if fe.MTime != "" {
+		if _, err := time.Parse(time.RFC3339Nano, fe.MTime); err != nil {
+			return fmt.Errorf("manifest entry %q: invalid mtime %q", fe.Path, fe.MTime)
+		}
+	}
+	return nil
+}
+
+// readRunMeta loads the pack's run_meta.json. A pack without one yields nil.
+func readRunMeta(outDir string) (*manifest.RunMeta, error) {
+	b, err := os.ReadFile(filepath.Join(outDir, "run_meta.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read run_meta.json: %w", err)
+	}
+	var meta manifest.RunMeta
+	if err := decodeStrict(b, &meta); err != nil {
+		return nil, fmt.Errorf("parse run_meta.json: %w", err)
+	}
+	return &meta, nil
+}
+
+// metaFilter rebuilds the path filter recorded in run_meta.json.
+// A nil meta or one without a recorded filter yields nil.
+func metaFilter(meta *manifest.RunMeta) (*pathfilter.Filter, error) {
+	if meta == nil || meta.Filter == nil {
+		return nil, nil
+	}
+	f, err := pathfilter.New(meta.Filter.Include, meta.Filter.Exclude, meta.Filter.Ignore)
+	if err != nil {
+		return nil, fmt.Errorf("run_meta.json filter: %w", err)
+	}
+	return f, nil
+}
+
+// inputScan selects which non-regular entries walkInputTree reports, mirroring
+// the policies the pack was built with.
+type inputScan struct {
+	links   bool // symlinks (reported with kind "symlink")
+	special bool // sockets, FIFOs, devices (reported with their specialKind)
+	dirs    bool // directories (reported with kind "dir")
+	// unreadable lists paths recorded under manifest "errors"; they and
+	// anything below them are left out.
+	unreadable map[string]bool
+}
+
+func scanFromMeta(meta *manifest.RunMeta) inputScan {
+	if meta == nil {
+		return inputScan{}
+	}
+	return inputScan{
+		links:   meta.Symlinks != "" && meta.Symlinks != string(SymlinksSkip),
+		special: meta.OnSpecial != "" && meta.OnSpecial != string(SpecialSkip),
+		dirs:    meta.RecordDirs,
+	}
+}
+
+// isSpecialKind reports whether a walkInputTree kind is a special file.
+func isSpecialKind(kind string) bool {
+	return kind != manifest.TypeFile && kind != manifest.TypeSymlink && kind != manifest.TypeDir
+}
+
+// walkInputTree lists the paths under inDir that survive filter, as clean
+// slash-separated paths mapped to their kind: manifest.TypeFile for regular
+// files, manifest.TypeSymlink for links, manifest.TypeDir for directories and a
+// specialKind for special files. Links, directories and special files are only
+// listed when scan asks for them.
+func walkInputTree(ctx context.Context, inDir string, filter *pathfilter.Filter, scan inputScan) (map[string]string, error) {
+	out := make(map[string]string, 64)
 	err := filepath.WalkDir(inDir, func(p string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
-		if d.IsDir() {
-			return nil
-		}
-		if !d.Type().IsRegular() {
-			return nil
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 		rel, err := filepath.Rel(inDir, p)
 		if err != nil {
@@ -239,10 +892,40 @@ func walkInputRegularFiles(inDir string) (map[string]struct{}, error) {
 		}
 		rel = filepath.ToSlash(rel)
 		rel = path.Clean(rel)
+		if rel == "." {
+			return nil
+		}
+		if filter.Excludes(rel, d.IsDir()) || scan.unreadable[rel] {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		kind := manifest.TypeFile
+		switch {
+		case d.IsDir():
+			if !scan.dirs || !filter.IncludesDir(rel) {
+				return nil
+			}
+			kind = manifest.TypeDir
+		case d.Type().IsRegular():
+		case d.Type()&fs.ModeSymlink != 0:
+			if !scan.links {
+				return nil
+			}
+			kind = manifest.TypeSymlink
+		default:
+			if !scan.special {
+				return nil
+			}
+			kind = specialKind(d.Type())
+		}
+
 		if err := validateRelPath(rel); err != nil {
 			return fmt.Errorf("input path invalid (%q): %w", rel, err)
 		}
-		out[rel] = struct{}{}
+		out[rel] = kind
 		return nil
 	})
 	if err != nil {
@@ -251,6 +934,97 @@ func walkInputRegularFiles(inDir string) (map[string]struct{}, error) {
 	return out, nil
 }
 
+// validateSkipped checks the manifest's skipped section (clean unique sorted
+// paths that do not collide with hashed entries) and the summary counts that
+// are not derived from sizes: file_count, dir_count, symlink_count and
+// skipped_count.
+func validateSkipped(m manifest.Manifest) error {
+	files := make(map[string]struct{}, len(m.Files))
+	for _, fe := range m.Files {
+		files[fe.Path] = struct{}{}
+	}
+	regular, dirs, symlinks := 0, 0, 0
+	for _, fe := range m.Files {
+		switch fe.Type {
+		case manifest.TypeDir:
+			dirs++
+		case manifest.TypeSymlink:
+			symlinks++
+		default:
+			regular++
+		}
+	}
+	if m.Summary.FileCount != regular {
+		return fmt.Errorf("summary.file_count mismatch: expected %d got %d", regular, m.Summary.FileCount)
+	}
+	if m.Summary.DirCount != dirs {
+		return fmt.Errorf("summary.dir_count mismatch: expected %d got %d", dirs, m.Summary.DirCount)
+	}
+	if m.Summary.SymlinkCount != symlinks {
+		return fmt.Errorf("summary.symlink_count mismatch: expected %d got %d", symlinks, m.Summary.SymlinkCount)
+	}
+
+	prev := ""
+	for i, se := range m.Skipped {
+		if err := validateRelPath(se.Path); err != nil {
+			return fmt.Errorf("manifest skipped path invalid (%q): %w", se.Path, err)
+		}
+		if se.Kind == "" {
+			return fmt.Errorf("manifest skipped entry %q has no kind", se.Path)
+		}
+		if _, ok := files[se.Path]; ok {
+			return fmt.Errorf("manifest path is both hashed and skipped: %q", se.Path)
+		}
+		if i > 0 && se.Path <= prev {
+			return fmt.Errorf("manifest skipped entries are not sorted/unique by path (determinism invariant)")
+		}
+		prev = se.Path
+	}
+	// Under --on-special=skip the count covers special files that are not
+	// listed, so it can only bound the list here; checkRunMeta pins it down.
+	if m.Summary.SkippedCount < len(m.Skipped) {
+		return fmt.Errorf("summary.skipped_count mismatch: expected at least %d got %d", len(m.Skipped), m.Summary.SkippedCount)
+	}
+	return nil
+}
+
+// validateErrors checks the manifest's errors section: clean unique sorted
+// paths with a class, none of which is also a hashed or skipped entry (a
+// recorded directory may be listed when its contents could not be read), and
+// summary.error_count.
+func validateErrors(m manifest.Manifest) error {
+	taken := make(map[string]struct{}, len(m.Files)+len(m.Skipped))
+	for _, fe := range m.Files {
+		if fe.Type != manifest.TypeDir {
+			taken[fe.Path] = struct{}{}
+		}
+	}
+	for _, se := range m.Skipped {
+		taken[se.Path] = struct{}{}
+	}
+
+	prev := ""
+	for i, ee := range m.Errors {
+		if err := validateRelPath(ee.Path); err != nil {
+			return fmt.Errorf("manifest error path invalid (%q): %w", ee.Path, err)
+		}
+		if ee.Class == "" {
+			return fmt.Errorf("manifest error entry %q has no class", ee.Path)
+		}
+		if _, ok := taken[ee.Path]; ok {
+			return fmt.Errorf("manifest path is both recorded and unreadable: %q", ee.Path)
+		}
+		if i > 0 && ee.Path <= prev {
+			return fmt.Errorf("manifest error entries are not sorted/unique by path (determinism invariant)")
+		}
+		prev = ee.Path
+	}
+	if m.Summary.ErrorCount != len(m.Errors) {
+		return fmt.Errorf("summary.error_count mismatch: expected %d got %d", len(m.Errors), m.Summary.ErrorCount)
+	}
+	return nil
+}
+
 func validateRelPath(p string) error {
 	if p == "" {
 		return fmt.Errorf("empty path")
@@ -272,27 +1046,14 @@ func validateRelPath(p string) error {
 }
 
 func isSHA256Hex(s string) bool {
-	if len(s) != 64 {
+	return isHexLen(s, 64)
+}
+
+// isHexLen reports whether s is lowercase-or-uppercase hex of exactly n characters.
+func isHexLen(s string, n int) bool {
+	if len(s) != n {
 		return false
 	}
 	_, err := hex.DecodeString(s)
 	return err == nil
 }
-
-func readLines(path string) ([]string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	var lines []string
-	sc := bufio.NewScanner(f)
-	for sc.Scan() {
-		lines = append(lines, sc.Text())
-	}
-	if err := sc.Err(); err != nil {
-		return nil, err
-	}
-	return lines, nil
-}
@@ -1,24 +1,76 @@
 package auditpack
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 )
 
+// tempFiles holds the temp files this process has created and not yet
+// renamed or removed, so RemoveTempFiles leaves other writers' alone.
+var tempFiles = struct {
+	sync.Mutex
+	paths map[string]struct{}
+}{paths: make(map[string]struct{})}
+
+// createTemp creates the temp file for name in dir and records it in
+// tempFiles; release forgets and removes it again.
+func createTemp(dir, name string) (f *os.File, release func(), err error) {
+	f, err = os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	p := f.Name()
+	tempFiles.Lock()
+	tempFiles.paths[p] = struct{}{}
+	tempFiles.Unlock()
+	return f, func() {
+		tempFiles.Lock()
+		delete(tempFiles.paths, p)
+		tempFiles.Unlock()
+		_ = os.Remove(p)
+	}, nil
+}
+
+// RemoveTempFiles deletes the *.tmp-* files this process created in or
+// below outDir and has not finished with, which is what an interrupted
+// writeFileAtomic can leave behind. Temp files of other processes (a signer
+// working on the same pack, say) are left alone. It returns the first error
+// but keeps going so that as much as possible is cleaned up.
+func RemoveTempFiles(outDir string) error {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	var first error
+	for p := range tempFiles.paths {
+		rel, err := filepath.Rel(outDir, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) && first == nil {
+			first = err
+		}
+		delete(tempFiles.paths, p)
+	}
+	return first
+}
+
 func writeFileAtomic(outDir, name string, data []byte) error {
 	if err := os.MkdirAll(outDir, 0o755); err != nil {
 		return err
 	}
 
-	tmp, err := os.CreateTemp(outDir, name+".tmp-*")
+	tmp, release, err := createTemp(outDir, name)
 	if err != nil {
 		return err
 	}
 	tmpName := tmp.Name()
 
 	// Ensure cleanup on error.
-	defer func() { _ = os.Remove(tmpName) }()
+	defer release()
 
 	if _, err := tmp.Write(data); err != nil {
 		_ = tmp.Close()
@@ -46,3 +98,56 @@ func writeFileAtomic(outDir, name string, data []byte) error {
 	return os.Chmod(finalPath, 0o644)
 
 }
+
+// writeFileExclusive is writeFileAtomic for a file that must not exist yet:
+// the complete file is linked into place, so it fails with fs.ErrExist
+// rather than replace another writer's file. Where hard links are not
+// supported, the name is claimed with O_EXCL instead and the complete file
+// renamed over the empty placeholder.
+func writeFileExclusive(outDir, name string, data []byte) error {
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+	tmp, release, err := createTemp(outDir, name)
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer release()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, 0o644); err != nil {
+		return err
+	}
+	finalPath := filepath.Join(outDir, name)
+	err = os.Link(tmpName, finalPath)
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	// No hard links here (FAT, some network filesystems).
+	f, err := os.OpenFile(finalPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(finalPath)
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// os.Rename cannot replace a file on Windows; the placeholder has
+		// done its job of claiming the name.
+		_ = os.Remove(finalPath)
+	}
+	if err := os.Rename(tmpName, finalPath); err != nil {
+		_ = os.Remove(finalPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Package checksums reads and writes checksum files in the formats produced by
+// GNU coreutils (sha256sum and friends) and BSD-style tools:
+//
+//	<hex>  <name>              GNU, text mode
+//	<hex> *<name>              GNU, binary mode (sha256sum -b)
+//	\<hex>  <escaped name>     GNU, name contains a backslash or newline
+//	SHA256 (<name>) = <hex>    BSD / --tag
+//
+// Names may contain spaces. Escaped names use \\, \n and \r; a line with an
+// escaped name starts with a backslash in either format. Parse(Format(e))
+// yields e again for every valid Entry.
+package checksums
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Entry is one checksum line.
+type Entry struct {
+	Sum  string // hex digest as written
+	Name string // file name, unescaped
+	// Binary is the GNU "*" marker. It does not change the digest.
+	Binary bool
+	// Tag is the algorithm tag of a BSD-style line ("SHA256", "SHA512",
+	// "SHA3-256", ...). Empty means a GNU-style line.
+	Tag string
+}
+
+// Parse reads a checksum file. Blank lines and lines starting with "#" are
+// skipped, and a trailing "\r" (CRLF line endings) is ignored. Errors name
+// the 1-based line number.
+func Parse(r io.Reader) ([]Entry, error) {
+	var out []Entry
+	sc := bufio.NewScanner(r)
+	n := 0
+	for sc.Scan() {
+		n++
+		ln := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.TrimSpace(ln) == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		e, err := ParseLine(ln)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		out = append(out, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParseLine parses one line, without its line ending.
+func ParseLine(ln string) (Entry, error) {
+	escaped := strings.HasPrefix(ln, `\`)
+	if escaped {
+		ln = ln[1:]
+	}
+
+	var e Entry
+	i := strings.IndexByte(ln, ' ')
+	if i <= 0 || i+2 > len(ln) {
+		return Entry{}, fmt.Errorf("malformed line: %q", ln)
+	}
+	switch {
+	case isHex(ln[:i]) && (ln[i+1] == ' ' || ln[i+1] == '*'):
+		// GNU: hex, a space, a mode character (' ' or '*'), then the name.
+		e = Entry{Sum: ln[:i], Name: ln[i+2:], Binary: ln[i+1] == '*'}
+	case ln[i+1] == '(':
+		// BSD: TAG (name) = hex. The name may itself contain ") = ", so
+		// split on the last one.
+		j := strings.LastIndex(ln, ") = ")
+		if j < i+2 {
+			return Entry{}, fmt.Errorf("malformed tagged line: %q", ln)
+		}
+		e = Entry{Tag: ln[:i], Name: ln[i+2 : j], Sum: ln[j+4:]}
+	default:
+		return Entry{}, fmt.Errorf("malformed line (want \"<hex>  <name>\", \"<hex> *<name>\" or \"TAG (<name>) = <hex>\"): %q", ln)
+	}
+
+	if !isHex(e.Sum) {
+		return Entry{}, fmt.Errorf("invalid checksum %q", e.Sum)
+	}
+	if e.Name == "" {
+		return Entry{}, errors.New("empty file name")
+	}
+	if escaped {
+		name, err := unescape(e.Name)
+		if err != nil {
+			return Entry{}, err
+		}
+		e.Name = name
+	}
+	return e, nil
+}
+
+// Format renders e as one line, without a line ending, escaping the name
+// the way GNU coreutils does when it contains a backslash or newline.
+func Format(e Entry) string {
+	name, escaped := escape(e.Name)
+	prefix := ""
+	if escaped {
+		prefix = `\`
+	}
+	if e.Tag != "" {
+		return prefix + e.Tag + " (" + name + ") = " + e.Sum
+	}
+	mode := " "
+	if e.Binary {
+		mode = "*"
+	}
+	return prefix + e.Sum + " " + mode + name
+}
+
+// Write writes entries in order, one line each, "\n"-terminated.
+func Write(w io.Writer, entries []Entry) error {
+	for _, e := range entries {
+		if _, err := io.WriteString(w, Format(e)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isHex(s string) bool {
+	if s == "" || len(s)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func escape(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return name, false
+	}
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+	return r.Replace(name), true
+}
+
+func unescape(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("trailing backslash in escaped name %q", s)
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in name %q", s[i], s)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,157 @@
+package hashing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Algorithm names. They double as the suffix of the pack checksum file
+// (manifest.sha256, manifest.sha512, ...).
+const (
+	SHA256   = "sha256"
+	SHA512   = "sha512"
+	SHA3_256 = "sha3-256"
+)
+
+// Hasher is a named digest algorithm.
+type Hasher struct {
+	Name string
+	New  func() hash.Hash
+}
+
+// HexLen is the length of a hex-encoded digest.
+func (h Hasher) HexLen() int {
+	return h.New().Size() * 2
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Hasher
+)
+
+func init() {
+	Register(Hasher{Name: SHA256, New: sha256.New})
+	Register(Hasher{Name: SHA512, New: sha512.New})
+	Register(Hasher{Name: SHA3_256, New: newSHA3_256})
+}
+
+// Register adds an algorithm. Registration order is the canonical order used
+// when listing algorithms, so it must not depend on runtime state.
+func Register(h Hasher) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, x := range registry {
+		if x.Name == h.Name {
+			panic("hashing: duplicate algorithm " + h.Name)
+		}
+	}
+	registry = append(registry, h)
+}
+
+// Lookup returns the algorithm registered under name.
+func Lookup(name string) (Hasher, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, x := range registry {
+		if x.Name == name {
+			return x, true
+		}
+	}
+	return Hasher{}, false
+}
+
+// Names lists the registered algorithms in canonical order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]string, 0, len(registry))
+	for _, x := range registry {
+		out = append(out, x.Name)
+	}
+	return out
+}
+
+// ParseNames parses a comma-separated algorithm list into canonical order
+// without duplicates. An empty string yields nil.
+func ParseNames(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	want := map[string]bool{}
+	for _, n := range strings.Split(s, ",") {
+		n = strings.ToLower(strings.TrimSpace(n))
+		if _, ok := Lookup(n); !ok {
+			return nil, fmt.Errorf("unknown digest algorithm %q (want one of %s)", n, strings.Join(Names(), ", "))
+		}
+		want[n] = true
+	}
+	out := make([]string, 0, len(want))
+	for _, n := range Names() {
+		if want[n] {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// Digests maps algorithm name to hex digest.
+type Digests map[string]string
+
+func newHashes(algs []string) ([]hash.Hash, io.Writer, error) {
+	hs := make([]hash.Hash, len(algs))
+	ws := make([]io.Writer, len(algs))
+	for i, a := range algs {
+		h, ok := Lookup(a)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown digest algorithm %q", a)
+		}
+		hs[i] = h.New()
+		ws[i] = hs[i]
+	}
+	return hs, io.MultiWriter(ws...), nil
+}
+
+func sums(algs []string, hs []hash.Hash) Digests {
+	out := make(Digests, len(algs))
+	for i, a := range algs {
+		out[a] = hex.EncodeToString(hs[i].Sum(nil))
+	}
+	return out
+}
+
+// HashReader computes every requested digest of r in a single pass.
+func HashReader(r io.Reader, algs []string) (Digests, int64, error) {
+	hs, w, err := newHashes(algs)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sums(algs, hs), n, nil
+}
+
+// HashFile computes every requested digest of the file at path in a single read.
+func HashFile(path string, algs []string) (Digests, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return HashReader(f, algs)
+}
+
+// HashBytes computes every requested digest of an in-memory value.
+func HashBytes(b []byte, algs []string) (Digests, error) {
+	d, _, err := HashReader(bytes.NewReader(b), algs)
+	return d, err
+}
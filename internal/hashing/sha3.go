@@ -0,0 +1,115 @@
+package hashing
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// SHA3-256 (FIPS 202), implemented here so the module keeps building with the
+// Go 1.22 standard library and no third-party dependencies.
+
+const (
+	sha3_256Size = 32
+	sha3_256Rate = 136 // (1600 - 2*256) / 8
+)
+
+var keccakRC = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A, 0x8000000080008000,
+	0x000000000000808B, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008A, 0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800A, 0x800000008000000A,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var keccakRotc = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+
+var keccakPiln = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+
+// keccakF1600 applies the Keccak-f[1600] permutation to st in place.
+func keccakF1600(st *[25]uint64) {
+	var bc [5]uint64
+	for round := 0; round < 24; round++ {
+		// Theta.
+		for i := 0; i < 5; i++ {
+			bc[i] = st[i] ^ st[i+5] ^ st[i+10] ^ st[i+15] ^ st[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := bc[(i+4)%5] ^ bits.RotateLeft64(bc[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				st[j+i] ^= t
+			}
+		}
+		// Rho and pi.
+		t := st[1]
+		for i := 0; i < 24; i++ {
+			j := keccakPiln[i]
+			bc[0] = st[j]
+			st[j] = bits.RotateLeft64(t, keccakRotc[i])
+			t = bc[0]
+		}
+		// Chi.
+		for j := 0; j < 25; j += 5 {
+			for i := 0; i < 5; i++ {
+				bc[i] = st[j+i]
+			}
+			for i := 0; i < 5; i++ {
+				st[j+i] ^= ^bc[(i+1)%5] & bc[(i+2)%5]
+			}
+		}
+		// Iota.
+		st[0] ^= keccakRC[round]
+	}
+}
+
+type sha3_256 struct {
+	st  [25]uint64
+	buf [sha3_256Rate]byte
+	n   int // bytes buffered in buf
+}
+
+func newSHA3_256() hash.Hash { return &sha3_256{} }
+
+func (d *sha3_256) Size() int      { return sha3_256Size }
+func (d *sha3_256) BlockSize() int { return sha3_256Rate }
+
+func (d *sha3_256) Reset() { *d = sha3_256{} }
+
+func (d *sha3_256) absorb() {
+	for i := 0; i < sha3_256Rate/8; i++ {
+		d.st[i] ^= binary.LittleEndian.Uint64(d.buf[i*8:])
+	}
+	keccakF1600(&d.st)
+	d.n = 0
+}
+
+func (d *sha3_256) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		c := copy(d.buf[d.n:], p)
+		d.n += c
+		p = p[c:]
+		if d.n == sha3_256Rate {
+			d.absorb()
+		}
+	}
+	return written, nil
+}
+
+func (d *sha3_256) Sum(in []byte) []byte {
+	// Pad a copy so the caller can keep writing.
+	dup := *d
+	for i := dup.n; i < sha3_256Rate; i++ {
+		dup.buf[i] = 0
+	}
+	dup.buf[dup.n] ^= 0x06
+	dup.buf[sha3_256Rate-1] ^= 0x80
+	dup.absorb()
+
+	var out [sha3_256Size]byte
+	for i := 0; i < sha3_256Size/8; i++ {
+		binary.LittleEndian.PutUint64(out[i*8:], dup.st[i])
+	}
+	return append(in, out[:]...)
+}
@@ -1,26 +1,105 @@
 package manifest
 
+// Entry types. Regular files leave Type empty so default manifests are unchanged.
+const (
+	TypeFile    = ""
+	TypeSymlink = "symlink"
+	TypeDir     = "dir"
+)
+
+// FileEntry describes one packed path. For a symlink entry, Target holds the
+// link text (slash-separated) and SizeBytes/SHA256 describe that text, not the
+// file it points to. Directory entries have no size or digest; every other
+// entry carries at least one digest.
 type FileEntry struct {
 	Path      string `json:"path"`
+	Type      string `json:"type,omitempty"`
+	Target    string `json:"target,omitempty"`
 	SizeBytes int64  `json:"size_bytes"`
-	SHA256    string `json:"sha256"`
+	SHA256    string `json:"sha256,omitempty"`
+	// Digests holds additional algorithms (e.g. "sha512", "sha3-256") by name.
+	// SHA-256 always lives in the SHA256 field.
+	Digests map[string]string `json:"digests,omitempty"`
+
+	// Optional POSIX metadata, present only when the build captured it.
+	Mode  string `json:"mode,omitempty"`  // permission bits in octal, e.g. "0644"
+	MTime string `json:"mtime,omitempty"` // RFC 3339 (UTC, nanoseconds)
+	UID   *int   `json:"uid,omitempty"`
+	GID   *int   `json:"gid,omitempty"`
+}
+
+// SkippedEntry records a path that was present in the input tree but not
+// hashed, such as a socket, FIFO or device node.
+type SkippedEntry struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// ErrorEntry records a path that could not be read when the pack was built
+// with --on-error=record. Class is "permission_denied", "not_found" or
+// "io_error". For a directory, nothing below it is covered by the pack.
+type ErrorEntry struct {
+	Path  string `json:"path"`
+	Class string `json:"class"`
 }
 
+// Summary totals a manifest. FileCount counts the regular file entries in
+// Files; DirCount and SymlinkCount count the directory and symlink entries.
 type Summary struct {
-	FileCount  int   `json:"file_count"`
-	TotalBytes int64 `json:"total_bytes"`
+	FileCount    int   `json:"file_count"`
+	TotalBytes   int64 `json:"total_bytes"`
+	SkippedCount int   `json:"skipped_count,omitempty"`
+	DirCount     int   `json:"dir_count,omitempty"`
+	SymlinkCount int   `json:"symlink_count,omitempty"`
+	ErrorCount   int   `json:"error_count,omitempty"`
 }
 
 type Manifest struct {
-	Version string      `json:"version"`
-	Input   string      `json:"input"`
-	Files   []FileEntry `json:"files"`
-	Summary Summary     `json:"summary"`
+	Version string         `json:"version"`
+	Input   string         `json:"input"`
+	Files   []FileEntry    `json:"files"`
+	Skipped []SkippedEntry `json:"skipped,omitempty"`
+	Errors  []ErrorEntry   `json:"errors,omitempty"`
+	Summary Summary        `json:"summary"`
+}
+
+// Filter records the path patterns that were active when the pack was built,
+// so verification can apply the same selection. Ignore holds the active lines
+// of the input root's .auditpackignore file.
+type Filter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	Ignore  []string `json:"ignore,omitempty"`
+}
+
+// Incremental records how a --baseline build obtained its digests.
+type Incremental struct {
+	Reused   int  `json:"reused"`
+	Rehashed int  `json:"rehashed"`
+	Paranoid bool `json:"paranoid,omitempty"`
 }
 
 type RunMeta struct {
 	Tool    string  `json:"tool"`
 	Version string  `json:"version"`
 	Input   string  `json:"input"`
-	Summary Summary `json:"summary"`
+	Filter  *Filter `json:"filter,omitempty"`
+	// Symlinks is the symlink policy used by the build; empty means "skip".
+	Symlinks string `json:"symlinks,omitempty"`
+	// OnSpecial is the special-file policy used by the build; empty means "skip".
+	OnSpecial string `json:"on_special,omitempty"`
+	// RecordDirs is set when directories were recorded as manifest entries.
+	RecordDirs bool `json:"record_dirs,omitempty"`
+	// Capture lists the metadata attributes recorded per entry (mode, mtime, uid, gid).
+	Capture []string `json:"capture,omitempty"`
+	// Digests lists the algorithms computed per entry when not just sha256.
+	Digests []string `json:"digests,omitempty"`
+	// OnError is the unreadable-path policy used by the build; empty means "fail".
+	OnError string `json:"on_error,omitempty"`
+	// Incomplete is set when some input paths could not be read, so the pack
+	// does not cover the whole input tree (see Manifest.Errors).
+	Incomplete bool `json:"incomplete,omitempty"`
+	// Incremental is set for builds that were given a baseline pack.
+	Incremental *Incremental `json:"incremental,omitempty"`
+	Summary     Summary      `json:"summary"`
 }
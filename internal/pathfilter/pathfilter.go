@@ -0,0 +1,233 @@
+// Package pathfilter decides which input paths belong in an audit pack.
+//
+// Paths are always relative, clean and slash-separated (the same form stored in
+// manifest.json). Patterns are globs in the path.Match dialect plus "**", which
+// matches zero or more whole path segments.
+package pathfilter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// IgnoreFileName is the ignore file Build reads from the root of the input tree.
+const IgnoreFileName = ".auditpackignore"
+
+// Match reports whether the slash-separated path name matches pattern.
+// "**" as a whole segment matches zero or more segments; every other segment
+// is matched with path.Match.
+func Match(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			// Collapse runs of "**".
+			for len(pat) > 0 && pat[0] == "**" {
+				pat = pat[1:]
+			}
+			if len(pat) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pat[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pat = pat[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// rule is one compiled gitignore-style pattern.
+type rule struct {
+	glob    string // anchored at the input root
+	negate  bool
+	dirOnly bool
+}
+
+func (r rule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return Match(r.glob, rel)
+}
+
+// compileRule turns a gitignore-style line into a rule:
+//   - a leading "!" negates the rule
+//   - a trailing "/" restricts it to directories
+//   - a pattern without an inner "/" matches at any depth; otherwise it is
+//     anchored at the input root (a leading "/" is optional)
+func compileRule(line string) (rule, error) {
+	var r rule
+	p := line
+	if strings.HasPrefix(p, "!") {
+		r.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return rule{}, fmt.Errorf("empty pattern: %q", line)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return rule{}, fmt.Errorf("bad pattern %q: %w", line, err)
+		}
+	}
+	if !anchored && !strings.HasPrefix(p, "**/") {
+		p = "**/" + p
+	}
+	r.glob = p
+	return r, nil
+}
+
+func compileRules(lines []string) ([]rule, error) {
+	out := make([]rule, 0, len(lines))
+	for _, ln := range lines {
+		r, err := compileRule(ln)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// ignored applies gitignore precedence: the last matching rule wins.
+func ignored(rules []rule, rel string, isDir bool) bool {
+	out := false
+	for _, r := range rules {
+		if r.matches(rel, isDir) {
+			out = !r.negate
+		}
+	}
+	return out
+}
+
+// ParseIgnoreFile returns the active pattern lines of an ignore file, in order.
+// Blank lines and "#" comments are dropped; trailing whitespace is trimmed and
+// CRLF line endings are accepted.
+func ParseIgnoreFile(data []byte) []string {
+	var out []string
+	for _, ln := range strings.Split(string(data), "\n") {
+		ln = strings.TrimRight(ln, " \t\r")
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		out = append(out, ln)
+	}
+	return out
+}
+
+// Filter combines --include/--exclude flags with ignore-file rules.
+type Filter struct {
+	include []rule
+	exclude []rule
+	ignore  []rule
+}
+
+// New compiles a Filter. include and exclude use the same pattern syntax as the
+// ignore file; ignore holds the lines returned by ParseIgnoreFile.
+func New(include, exclude, ignore []string) (*Filter, error) {
+	for _, p := range include {
+		if strings.HasPrefix(p, "!") {
+			return nil, fmt.Errorf("include: negated patterns are not supported: %q", p)
+		}
+	}
+	inc, err := compileRules(include)
+	if err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	exc, err := compileRules(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	ign, err := compileRules(ignore)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", IgnoreFileName, err)
+	}
+	return &Filter{include: inc, exclude: exc, ignore: ign}, nil
+}
+
+// Excludes reports whether rel (and, for directories, its whole subtree) is
+// filtered out. A path is excluded if any ancestor directory is excluded, if the
+// ignore or exclude rules match it, or if include patterns are set and neither
+// a non-directory path nor any of its ancestors matches one of them.
+// A nil Filter excludes nothing.
+func (f *Filter) Excludes(rel string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	segs := strings.Split(rel, "/")
+	for i := 1; i < len(segs); i++ {
+		if f.excludesOne(strings.Join(segs[:i], "/"), true) {
+			return true
+		}
+	}
+	if f.excludesOne(rel, isDir) {
+		return true
+	}
+	if !isDir && len(f.include) > 0 {
+		return !f.included(segs, false)
+	}
+	return false
+}
+
+// Includes reports whether rel, or one of its ancestor directories, matches
+// an include pattern. The exclude and ignore rules are not consulted.
+func (f *Filter) Includes(rel string) bool {
+	return f.included(strings.Split(rel, "/"), false)
+}
+
+// IncludesDir reports whether the directory rel is itself selected: with
+// include patterns set, it or one of its ancestors must match one. Excludes
+// keeps other directories so their subtrees are walked for matching files,
+// but they are not recorded as entries. A nil Filter, or one without
+// include patterns, includes every directory.
+func (f *Filter) IncludesDir(rel string) bool {
+	if f == nil || len(f.include) == 0 {
+		return true
+	}
+	return f.included(strings.Split(rel, "/"), true)
+}
+
+// included reports whether the path or one of its ancestor directories
+// matches an include pattern; isDir says whether the path is a directory.
+func (f *Filter) included(segs []string, isDir bool) bool {
+	for i := 1; i <= len(segs); i++ {
+		p := strings.Join(segs[:i], "/")
+		isDir := i < len(segs) || isDir
+		for _, r := range f.include {
+			if r.matches(p, isDir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *Filter) excludesOne(rel string, isDir bool) bool {
+	return ignored(f.ignore, rel, isDir) || ignored(f.exclude, rel, isDir)
+}
@@ -0,0 +1,240 @@
+package signing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AllowedSigner is one line of an OpenSSH allowed_signers file (see
+// ssh-keygen(1), ALLOWED SIGNERS).
+type AllowedSigner struct {
+	Line          int
+	Principals    string // pattern list
+	Namespaces    string // pattern list; empty allows every namespace
+	CertAuthority bool
+	ValidAfter    time.Time // zero when unset
+	ValidBefore   time.Time // zero when unset
+	KeyType       string
+	Key           []byte // SSH wire format
+}
+
+// ParseAllowedSigners parses an allowed_signers file. Blank lines and "#"
+// comments are skipped.
+func ParseAllowedSigners(data []byte) ([]AllowedSigner, error) {
+	var out []AllowedSigner
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		s.Line = i + 1
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func parseAllowedSigner(line string) (AllowedSigner, error) {
+	var s AllowedSigner
+	principals, rest, err := nextToken(line)
+	if err != nil {
+		return s, err
+	}
+	s.Principals = strings.Trim(principals, `"`)
+	if s.Principals == "" {
+		return s, errors.New("empty principals")
+	}
+
+	tok, after, err := nextToken(rest)
+	if err != nil {
+		return s, err
+	}
+	if !isSSHKeyType(tok) {
+		if err := s.parseOptions(tok); err != nil {
+			return s, err
+		}
+		if tok, after, err = nextToken(after); err != nil {
+			return s, err
+		}
+	}
+	s.KeyType = tok
+	keyText, _, err := nextToken(after)
+	if err != nil {
+		return s, errors.New("missing public key")
+	}
+	if s.Key, err = base64.StdEncoding.DecodeString(keyText); err != nil {
+		return s, fmt.Errorf("public key is not base64: %w", err)
+	}
+	r := wireReader{b: s.Key}
+	if typ := string(r.string()); r.err != nil || typ != s.KeyType {
+		return s, fmt.Errorf("key type %q does not match the encoded key", s.KeyType)
+	}
+	return s, nil
+}
+
+// nextToken splits off the first whitespace-separated token of s; double
+// quotes protect whitespace.
+func nextToken(s string) (tok, rest string, err error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" {
+		return "", "", errors.New("unexpected end of line")
+	}
+	quoted := false
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case (c == ' ' || c == '\t') && !quoted:
+			return s[:i], s[i:], nil
+		}
+	}
+	if quoted {
+		return "", "", errors.New("unterminated quote")
+	}
+	return s, "", nil
+}
+
+func isSSHKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") ||
+		strings.HasPrefix(s, "sk-ssh-") || strings.HasPrefix(s, "sk-ecdsa-")
+}
+
+// parseOptions parses the comma-separated options field.
+func (s *AllowedSigner) parseOptions(field string) error {
+	var opts []string
+	start, quoted := 0, false
+	for i, c := range field {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			opts = append(opts, field[start:i])
+			start = i + 1
+		}
+	}
+	opts = append(opts, field[start:])
+
+	for _, opt := range opts {
+		name, value, hasValue := strings.Cut(opt, "=")
+		name = strings.ToLower(name)
+		if hasValue {
+			if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+				return fmt.Errorf("option %s: value must be double-quoted", name)
+			}
+			value = value[1 : len(value)-1]
+		}
+		var err error
+		switch {
+		case name == "cert-authority" && !hasValue:
+			s.CertAuthority = true
+		case name == "namespaces" && hasValue:
+			s.Namespaces = value
+		case name == "valid-after" && hasValue:
+			s.ValidAfter, err = parseSignerTime(value)
+		case name == "valid-before" && hasValue:
+			s.ValidBefore, err = parseSignerTime(value)
+		default:
+			return fmt.Errorf("unsupported option %q", opt)
+		}
+		if err != nil {
+			return fmt.Errorf("option %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseSignerTime parses YYYYMMDD[HHMM[SS]] with an optional trailing "Z"
+// for UTC; otherwise the time is local.
+func parseSignerTime(v string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(v, "Z") {
+		loc, v = time.UTC, strings.TrimSuffix(v, "Z")
+	}
+	layouts := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(v)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	return time.ParseInLocation(layout, v, loc)
+}
+
+// Authorize checks that key may sign for identity in namespace at time now,
+// according to signers. Like ssh-keygen -Y verify, it accepts the key if any
+// line authorizes it; a line for the key and identity that a namespace or
+// validity option rejects (a rotated or expired entry, say) only supplies
+// the error when no later line authorizes it either. Certificate-authority
+// lines are not supported and never match.
+func Authorize(signers []AllowedSigner, identity, namespace string, key []byte, now time.Time) error {
+	var rejected error
+	for _, s := range signers {
+		if s.CertAuthority || !bytes.Equal(s.Key, key) || !matchPatternList(s.Principals, identity) {
+			continue
+		}
+		var err error
+		switch {
+		case s.Namespaces != "" && !matchPatternList(s.Namespaces, namespace):
+			err = fmt.Errorf("allowed_signers line %d does not allow namespace %q", s.Line, namespace)
+		case !s.ValidAfter.IsZero() && now.Before(s.ValidAfter):
+			err = fmt.Errorf("allowed_signers line %d is not valid before %s", s.Line, s.ValidAfter.Format(time.RFC3339))
+		case !s.ValidBefore.IsZero() && !now.Before(s.ValidBefore):
+			err = fmt.Errorf("allowed_signers line %d expired at %s", s.Line, s.ValidBefore.Format(time.RFC3339))
+		default:
+			return nil
+		}
+		if rejected == nil {
+			rejected = err
+		}
+	}
+	if rejected != nil {
+		return rejected
+	}
+	return fmt.Errorf("key %s is not an allowed signer for %q", SSHFingerprint(key), identity)
+}
+
+// matchPatternList reports whether s matches the comma-separated OpenSSH
+// pattern list: "*" and "?" wildcards, and "!" negation, which wins.
+func matchPatternList(list, s string) bool {
+	matched := false
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if neg := strings.HasPrefix(p, "!"); neg {
+			if matchPattern(p[1:], s) {
+				return false
+			}
+		} else if matchPattern(p, s) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func matchPattern(p, s string) bool {
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(p[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != p[0] {
+				return false
+			}
+		}
+		p, s = p[1:], s[1:]
+	}
+	return len(s) == 0
+}
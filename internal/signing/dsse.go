@@ -0,0 +1,237 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Envelope is a DSSE (Dead Simple Signing Envelope) v1 envelope: a payload,
+// its type, and any number of signatures over PAE(payloadType, payload).
+type Envelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"` // base64
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+// DSSESignature is one signature in an Envelope.
+type DSSESignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"` // base64
+}
+
+// PAE is the DSSE v1 pre-authentication encoding; signatures cover it rather
+// than the bare payload, so they are bound to the payload type.
+func PAE(payloadType string, payload []byte) []byte {
+	b := []byte("DSSEv1 ")
+	b = strconv.AppendInt(b, int64(len(payloadType)), 10)
+	b = append(b, ' ')
+	b = append(b, payloadType...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(payload)), 10)
+	b = append(b, ' ')
+	return append(b, payload...)
+}
+
+// Signer signs DSSE envelopes. NewSigner provides Ed25519 and ECDSA P-256
+// signers; any other implementation (an HSM or KMS client, say) can be used
+// the same way.
+type Signer interface {
+	KeyID() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier checks DSSE signatures made by one key.
+type Verifier interface {
+	KeyID() string
+	Verify(data, sig []byte) error
+}
+
+// NewSigner returns a Signer for an Ed25519 or ECDSA P-256 private key. Its
+// key id is KeyID of the public key. ECDSA signatures are ASN.1 DER over the
+// SHA-256 of the signed data.
+func NewSigner(key crypto.Signer) (Signer, error) {
+	alg, err := KeyAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	id, err := KeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return keySigner{key: key, alg: alg, id: id}, nil
+}
+
+type keySigner struct {
+	key crypto.Signer
+	alg string
+	id  string
+}
+
+func (s keySigner) KeyID() string { return s.id }
+
+func (s keySigner) Sign(data []byte) ([]byte, error) {
+	if s.alg == AlgECDSAP256 {
+		sum := sha256.Sum256(data)
+		return s.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	return s.key.Sign(rand.Reader, data, crypto.Hash(0))
+}
+
+// NewVerifier returns a Verifier for an Ed25519 or ECDSA P-256 public key.
+func NewVerifier(pub crypto.PublicKey) (Verifier, error) {
+	alg, err := KeyAlgorithm(pub)
+	if err != nil {
+		return nil, err
+	}
+	id, err := KeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	return keyVerifier{pub: pub, alg: alg, id: id}, nil
+}
+
+type keyVerifier struct {
+	pub crypto.PublicKey
+	alg string
+	id  string
+}
+
+func (v keyVerifier) KeyID() string { return v.id }
+
+func (v keyVerifier) Verify(data, sig []byte) error {
+	var ok bool
+	if v.alg == AlgECDSAP256 {
+		sum := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(v.pub.(*ecdsa.PublicKey), sum[:], sig)
+	} else {
+		ok = ed25519.Verify(v.pub.(ed25519.PublicKey), data, sig)
+	}
+	if !ok {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// NewEnvelope returns an unsigned envelope for payload.
+func NewEnvelope(payloadType string, payload []byte) *Envelope {
+	return &Envelope{PayloadType: payloadType, Payload: base64.StdEncoding.EncodeToString(payload), Signatures: []DSSESignature{}}
+}
+
+// ParseEnvelope decodes a JSON envelope and its payload.
+func ParseEnvelope(data []byte) (*Envelope, []byte, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, nil, fmt.Errorf("not a DSSE envelope: %w", err)
+	}
+	if env.PayloadType == "" {
+		return nil, nil, errors.New("DSSE envelope has no payloadType")
+	}
+	payload, err := env.DecodePayload()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &env, payload, nil
+}
+
+// DecodePayload returns the payload bytes.
+func (e *Envelope) DecodePayload() ([]byte, error) {
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("DSSE payload is not base64: %w", err)
+	}
+	return payload, nil
+}
+
+// Sign adds a signature by s. An envelope holds at most one signature per
+// key id.
+func (e *Envelope) Sign(s Signer) error {
+	for _, sig := range e.Signatures {
+		if sig.KeyID == s.KeyID() {
+			return fmt.Errorf("envelope is already signed by key %s", s.KeyID())
+		}
+	}
+	payload, err := e.DecodePayload()
+	if err != nil {
+		return err
+	}
+	sig, err := s.Sign(PAE(e.PayloadType, payload))
+	if err != nil {
+		return err
+	}
+	e.Signatures = append(e.Signatures, DSSESignature{KeyID: s.KeyID(), Sig: base64.StdEncoding.EncodeToString(sig)})
+	return nil
+}
+
+// SignatureCheck is the result for one envelope signature.
+type SignatureCheck struct {
+	KeyID string `json:"keyid"`
+	Known bool   `json:"known"` // a given verifier has this key id or verifies the signature
+	Valid bool   `json:"valid"`
+	// VerifiedBy is the key id of the verifier the signature is valid for.
+	// It differs from KeyID when the signature's keyid is empty or unknown.
+	VerifiedBy string `json:"verified_by,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
+// Check verifies every signature in e against the verifier with the same key
+// id. The keyid field is only a hint (DSSE does not authenticate it), so a
+// signature with an empty or unknown keyid is tried against every verifier;
+// one that none of them verifies is reported as unknown.
+func (e *Envelope) Check(verifiers []Verifier) ([]SignatureCheck, error) {
+	payload, err := e.DecodePayload()
+	if err != nil {
+		return nil, err
+	}
+	pae := PAE(e.PayloadType, payload)
+	byID := make(map[string]Verifier, len(verifiers))
+	for _, v := range verifiers {
+		byID[v.KeyID()] = v
+	}
+	out := make([]SignatureCheck, 0, len(e.Signatures))
+	for _, s := range e.Signatures {
+		c := SignatureCheck{KeyID: s.KeyID}
+		v, ok := byID[s.KeyID]
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		switch {
+		case err != nil:
+			c.Known, c.Err = ok, "signature is not base64"
+		case ok:
+			c.Known = true
+			if err := v.Verify(pae, sig); err != nil {
+				c.Err = err.Error()
+			} else {
+				c.Valid, c.VerifiedBy = true, v.KeyID()
+			}
+		default:
+			c.Err = "no trusted key with this key id"
+			if s.KeyID == "" {
+				c.Err = "no key id, and no trusted key verifies it"
+			}
+			for _, v := range verifiers {
+				if v.Verify(pae, sig) == nil {
+					c.Known, c.Valid, c.VerifiedBy, c.Err = true, true, v.KeyID(), ""
+					break
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Marshal renders the envelope as indented JSON with a trailing newline.
+func (e *Envelope) Marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,191 @@
+// Package signing reads and writes the key and signature files used to seal
+// audit packs.
+//
+// Keys are Ed25519 or ECDSA P-256 PEM files: private keys as PKCS #8
+// ("PRIVATE KEY"), public keys as PKIX ("PUBLIC KEY"), the same encodings
+// `openssl genpkey` and `openssl pkey -pubout` produce. A detached signature
+// file holds the base64 signature on one line. DSSE envelopes (dsse.go) wrap
+// signatures together with the type of the signed payload.
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// PEM block types for key files.
+const (
+	PrivateKeyPEMType = "PRIVATE KEY"
+	PublicKeyPEMType  = "PUBLIC KEY"
+)
+
+// Key algorithms.
+const (
+	AlgEd25519   = "ed25519"
+	AlgECDSAP256 = "ecdsa-p256"
+)
+
+// GenerateKey returns a new private key for alg (AlgEd25519 or AlgECDSAP256).
+func GenerateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case AlgEd25519:
+		_, priv, err := GenerateEd25519()
+		return priv, err
+	case AlgECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unknown key algorithm %q (want %s or %s)", alg, AlgEd25519, AlgECDSAP256)
+	}
+}
+
+// GenerateEd25519 returns a new Ed25519 key pair.
+func GenerateEd25519() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// MarshalPrivateKey encodes key as a PKCS #8 PEM block.
+func MarshalPrivateKey(key crypto.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PrivateKeyPEMType, Bytes: der}), nil
+}
+
+// MarshalPublicKey encodes key as a PKIX PEM block.
+func MarshalPublicKey(key crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PublicKeyPEMType, Bytes: der}), nil
+}
+
+// ParsePrivateKey decodes a PKCS #8 PEM private key, which must be an
+// Ed25519 or ECDSA P-256 key.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	der, err := pemBytes(data, PrivateKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("private key is %T, want an Ed25519 or ECDSA P-256 key", key)
+	}
+	if _, err := KeyAlgorithm(signer.Public()); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// ParsePublicKey decodes a PKIX PEM public key, which must be an Ed25519 or
+// ECDSA P-256 key.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	der, err := pemBytes(data, PublicKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	if _, err := KeyAlgorithm(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParseEd25519PrivateKey is ParsePrivateKey for a key that must be Ed25519.
+func ParseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is %T, want an Ed25519 key", key)
+	}
+	return priv, nil
+}
+
+// ParseEd25519PublicKey is ParsePublicKey for a key that must be Ed25519.
+func ParseEd25519PublicKey(data []byte) (ed25519.PublicKey, error) {
+	key, err := ParsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is %T, want an Ed25519 key", key)
+	}
+	return pub, nil
+}
+
+// KeyAlgorithm names the algorithm of a public key (AlgEd25519 or
+// AlgECDSAP256), or fails for any other kind of key.
+func KeyAlgorithm(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return AlgEd25519, nil
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return AlgECDSAP256, nil
+		}
+		return "", fmt.Errorf("ECDSA key on curve %s is not supported, want P-256", k.Curve.Params().Name)
+	default:
+		return "", fmt.Errorf("key is %T, want an Ed25519 or ECDSA P-256 key", pub)
+	}
+}
+
+func pemBytes(data []byte, typ string) ([]byte, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM %q block found", typ)
+	}
+	if block.Type != typ {
+		return nil, fmt.Errorf("PEM block is %q, want %q", block.Type, typ)
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, errors.New("trailing data after PEM block")
+	}
+	return block.Bytes, nil
+}
+
+// KeyID identifies a public key: the hex SHA-256 of its PKIX encoding.
+func KeyID(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// EncodeSignature renders a detached signature file: base64 and a newline.
+func EncodeSignature(sig []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+// DecodeSignature parses a detached signature file.
+func DecodeSignature(data []byte) ([]byte, error) {
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("signature is not base64: %w", err)
+	}
+	return sig, nil
+}
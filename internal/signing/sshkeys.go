@@ -0,0 +1,246 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// SSHKeyTypeEd25519 is the only OpenSSH key type supported.
+const SSHKeyTypeEd25519 = "ssh-ed25519"
+
+// SSHSigner signs with an OpenSSH key: a key read from a file or one held by
+// ssh-agent.
+type SSHSigner interface {
+	// PublicKey returns the key in SSH wire format.
+	PublicKey() []byte
+	// Sign returns an SSH signature blob (key type and raw signature) over data.
+	Sign(data []byte) ([]byte, error)
+}
+
+// LoadSSHSigner returns a signer for the OpenSSH key file at path. An
+// unencrypted "OPENSSH PRIVATE KEY" signs directly. For a passphrase-protected
+// private key, or a public key file (id_ed25519.pub), the matching key must
+// be loaded in the ssh-agent at $SSH_AUTH_SOCK, which does the signing.
+func LoadSSHSigner(path string) (SSHSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "OPENSSH PRIVATE KEY" {
+			return nil, fmt.Errorf("%s: PEM block is %q, want an OpenSSH private key", path, block.Type)
+		}
+		pub, priv, err := parseOpenSSHPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if priv != nil {
+			return sshEd25519Key{priv}, nil
+		}
+		return newAgentSigner(pub)
+	}
+	pub, _, err := ParseSSHPublicKeyLine(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not an OpenSSH private or public key: %w", path, err)
+	}
+	return newAgentSigner(pub)
+}
+
+type sshEd25519Key struct {
+	priv ed25519.PrivateKey
+}
+
+func (k sshEd25519Key) PublicKey() []byte {
+	return marshalSSHEd25519(k.priv.Public().(ed25519.PublicKey))
+}
+
+func (k sshEd25519Key) Sign(data []byte) ([]byte, error) {
+	var w wireWriter
+	w.string([]byte(SSHKeyTypeEd25519))
+	w.string(ed25519.Sign(k.priv, data))
+	return w.b, nil
+}
+
+func marshalSSHEd25519(pub ed25519.PublicKey) []byte {
+	var w wireWriter
+	w.string([]byte(SSHKeyTypeEd25519))
+	w.string(pub)
+	return w.b
+}
+
+// parseSSHEd25519 decodes an SSH wire-format public key.
+func parseSSHEd25519(blob []byte) (ed25519.PublicKey, error) {
+	r := wireReader{b: blob}
+	typ := string(r.string())
+	key := r.string()
+	if err := r.done(); err != nil {
+		return nil, fmt.Errorf("public key: %w", err)
+	}
+	if typ != SSHKeyTypeEd25519 {
+		return nil, fmt.Errorf("public key type %q is not supported (want %s)", typ, SSHKeyTypeEd25519)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("public key: bad Ed25519 key length")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ParseSSHPublicKeyLine parses "ssh-ed25519 AAAA... [comment]", the format
+// of id_ed25519.pub, returning the wire-format key and the comment.
+func ParseSSHPublicKeyLine(line string) (blob []byte, comment string, err error) {
+	fields := strings.Fields(strings.TrimSpace(line))
+	if len(fields) < 2 {
+		return nil, "", errors.New("want \"<type> <base64 key> [comment]\"")
+	}
+	blob, err = base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, "", fmt.Errorf("public key is not base64: %w", err)
+	}
+	if _, err := parseSSHEd25519(blob); err != nil {
+		return nil, "", err
+	}
+	r := wireReader{b: blob}
+	if typ := string(r.string()); typ != fields[0] {
+		return nil, "", fmt.Errorf("key type %q does not match the encoded key (%s)", fields[0], typ)
+	}
+	return blob, strings.Join(fields[2:], " "), nil
+}
+
+// SSHFingerprint renders a wire-format key the way ssh-keygen -l does:
+// "SHA256:" and the unpadded base64 SHA-256 of the key.
+func SSHFingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// parseOpenSSHPrivateKey decodes the "openssh-key-v1" format (PROTOCOL.key).
+// priv is nil when the private section is encrypted; pub is always set.
+func parseOpenSSHPrivateKey(b []byte) (pub []byte, priv ed25519.PrivateKey, err error) {
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(b, []byte(magic)) {
+		return nil, nil, errors.New("not an openssh-key-v1 private key")
+	}
+	r := wireReader{b: b[len(magic):]}
+	cipher := string(r.string())
+	kdf := string(r.string())
+	r.string() // kdf options
+	n := r.uint32()
+	if r.err == nil && n != 1 {
+		return nil, nil, fmt.Errorf("key file holds %d keys, want 1", n)
+	}
+	pub = r.string()
+	section := r.string()
+	if err := r.done(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := parseSSHEd25519(pub); err != nil {
+		return nil, nil, err
+	}
+	if cipher != "none" || kdf != "none" {
+		return pub, nil, nil
+	}
+
+	s := wireReader{b: section}
+	check1, check2 := s.uint32(), s.uint32()
+	typ := string(s.string())
+	keyPub := s.string()
+	keyPriv := s.string()
+	s.string() // comment
+	if s.err != nil {
+		return nil, nil, fmt.Errorf("private key: %w", s.err)
+	}
+	if check1 != check2 {
+		return nil, nil, errors.New("private key: check bytes differ")
+	}
+	for i, p := range s.b { // padding is 1, 2, 3, ...
+		if int(p) != i+1 {
+			return nil, nil, errors.New("private key: bad padding")
+		}
+	}
+	if typ != SSHKeyTypeEd25519 || len(keyPriv) != ed25519.PrivateKeySize || !bytes.Equal(keyPub, keyPriv[32:]) {
+		return nil, nil, fmt.Errorf("private key type %q is not a valid %s key", typ, SSHKeyTypeEd25519)
+	}
+	if !bytes.Equal(marshalSSHEd25519(ed25519.PublicKey(keyPub)), pub) {
+		return nil, nil, errors.New("private key does not match its public key")
+	}
+	return pub, ed25519.PrivateKey(bytes.Clone(keyPriv)), nil
+}
+
+// ssh-agent protocol messages (draft-miller-ssh-agent).
+const (
+	agentFailure         = 5
+	agentSignRequest     = 13
+	agentSignResponse    = 14
+	maxAgentResponseSize = 1 << 18
+)
+
+// agentSigner signs through ssh-agent.
+type agentSigner struct {
+	sock string
+	pub  []byte
+}
+
+func newAgentSigner(pub []byte) (SSHSigner, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("the key is passphrase-protected or only public: load it with ssh-add (SSH_AUTH_SOCK is not set)")
+	}
+	return agentSigner{sock: sock, pub: pub}, nil
+}
+
+func (a agentSigner) PublicKey() []byte { return a.pub }
+
+func (a agentSigner) Sign(data []byte) ([]byte, error) {
+	conn, err := net.Dial("unix", a.sock)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	defer conn.Close()
+
+	var req wireWriter
+	req.raw([]byte{agentSignRequest})
+	req.string(a.pub)
+	req.string(data)
+	req.uint32(0) // flags
+	var msg wireWriter
+	msg.string(req.b)
+	if _, err := conn.Write(msg.b); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n == 0 || n > maxAgentResponseSize {
+		return nil, fmt.Errorf("ssh-agent: bad response length %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	switch resp[0] {
+	case agentSignResponse:
+	case agentFailure:
+		return nil, fmt.Errorf("ssh-agent refused to sign: is key %s loaded (ssh-add -l)?", SSHFingerprint(a.pub))
+	default:
+		return nil, fmt.Errorf("ssh-agent: unexpected response type %d", resp[0])
+	}
+	r := wireReader{b: resp[1:]}
+	sig := r.string()
+	if err := r.done(); err != nil {
+		return nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	return sig, nil
+}
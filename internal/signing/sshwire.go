@@ -0,0 +1,74 @@
+package signing
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errShortWire reports SSH wire data that ends early.
+var errShortWire = errors.New("truncated SSH wire data")
+
+// wireReader decodes the SSH wire encoding (RFC 4251 section 5).
+type wireReader struct {
+	b   []byte
+	err error
+}
+
+func (r *wireReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = errShortWire
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *wireReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// string reads an SSH "string": a uint32 length and that many bytes.
+func (r *wireReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(n) > uint64(len(r.b)) {
+		r.err = errShortWire
+		return nil
+	}
+	return r.bytes(int(n))
+}
+
+// done returns the first decoding error, or an error if data is left over.
+func (r *wireReader) done() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.b) != 0 {
+		return errors.New("trailing SSH wire data")
+	}
+	return nil
+}
+
+// wireWriter builds SSH wire data.
+type wireWriter struct {
+	b []byte
+}
+
+func (w *wireWriter) raw(b []byte) { w.b = append(w.b, b...) }
+
+func (w *wireWriter) uint32(v uint32) { w.b = binary.BigEndian.AppendUint32(w.b, v) }
+
+func (w *wireWriter) string(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.raw(b)
+}
@@ -0,0 +1,334 @@
+package tests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+type member struct {
+	name string
+	body string
+	typ  byte // tar type flag; 0 means a regular file
+	link string
+}
+
+func writeTar(t *testing.T, p string, gz bool, members []member) {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+	var zw *gzip.Writer
+	tw := tar.NewWriter(f)
+	if gz {
+		zw = gzip.NewWriter(f)
+		tw = tar.NewWriter(zw)
+	}
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0o644, Typeflag: m.typ, Linkname: m.link, Format: tar.FormatPAX}
+		if m.typ == 0 {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(m.body))
+		}
+		if m.typ == tar.TypeDir {
+			hdr.Mode = 0o755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tar header %q: %v", m.name, err)
+		}
+		if _, err := tw.Write([]byte(m.body)); err != nil {
+			t.Fatalf("tar write %q: %v", m.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatalf("gzip close: %v", err)
+		}
+	}
+}
+
+func writeZip(t *testing.T, p string, members []member) {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, m := range members {
+		fh := &zip.FileHeader{Name: m.name, Method: zip.Deflate}
+		switch m.typ {
+		case tar.TypeDir:
+			fh.SetMode(os.ModeDir | 0o755)
+		case tar.TypeSymlink:
+			fh.SetMode(os.ModeSymlink | 0o777)
+			m.body = m.link
+		default:
+			fh.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatalf("zip header %q: %v", m.name, err)
+		}
+		if _, err := w.Write([]byte(m.body)); err != nil {
+			t.Fatalf("zip write %q: %v", m.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+}
+
+// writeV7Tar writes members as an old V7 tar archive: headers without the
+// "ustar" magic, which archive/tar cannot produce.
+func writeV7Tar(t *testing.T, p string, members []member) {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range members {
+		typ := m.typ
+		if typ == 0 {
+			typ = tar.TypeReg
+		}
+		hdr := make([]byte, 512)
+		copy(hdr[0:100], m.name)
+		copy(hdr[100:108], "0000644\x00")
+		copy(hdr[108:116], "0000000\x00")
+		copy(hdr[116:124], "0000000\x00")
+		copy(hdr[124:136], fmt.Sprintf("%011o\x00", len(m.body)))
+		copy(hdr[136:148], "00000000000\x00")
+		hdr[156] = typ
+		copy(hdr[157:257], m.link)
+		copy(hdr[148:156], "        ")
+		sum := 0
+		for _, c := range hdr {
+			sum += int(c)
+		}
+		copy(hdr[148:156], fmt.Sprintf("%06o\x00 ", sum))
+		buf.Write(hdr)
+		buf.WriteString(m.body)
+		if pad := len(m.body) % 512; pad != 0 {
+			buf.Write(make([]byte, 512-pad))
+		}
+	}
+	buf.Write(make([]byte, 1024))
+	mustWrite(t, p, buf.Bytes())
+}
+
+// archiveInput is the input tree the archive tests pack, as archive members.
+var archiveInput = []member{
+	{name: "./", typ: tar.TypeDir},
+	{name: "./docs/", typ: tar.TypeDir},
+	{name: "./docs/a.txt", body: "alpha\n"},
+	{name: "./docs/b.txt", body: "bravo\n"},
+	{name: "./top.txt", body: "top\n"},
+	{name: "./link", typ: tar.TypeSymlink, link: "top.txt"},
+}
+
+func archivePack(t *testing.T) (outDir string) {
+	t.Helper()
+	inDir := filepath.Join(t.TempDir(), "in")
+	for _, m := range archiveInput {
+		if m.typ == 0 {
+			mustWrite(t, filepath.Join(inDir, filepath.FromSlash(m.name)), []byte(m.body))
+		}
+	}
+	mustSymlink(t, "top.txt", filepath.Join(inDir, "link"))
+	outDir = t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Symlinks = auditpack.SymlinksRecord
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return outDir
+}
+
+func verifyArchive(t *testing.T, archive, outDir string, strict bool) *auditpack.VerifyReport {
+	t.Helper()
+	rep, err := auditpack.VerifyArchiveReport(context.Background(), archive, outDir, auditpack.VerifyOptions{Strict: strict})
+	if err != nil {
+		t.Fatalf("verify archive: %v", err)
+	}
+	return rep
+}
+
+func TestVerifyArchive_TarGzTarAndZip(t *testing.T) {
+	t.Parallel()
+	outDir := archivePack(t)
+	dir := t.TempDir()
+
+	tgz := filepath.Join(dir, "evidence.tar.gz")
+	writeTar(t, tgz, true, archiveInput)
+	plain := filepath.Join(dir, "evidence.tar")
+	writeTar(t, plain, false, archiveInput)
+	zipped := filepath.Join(dir, "evidence.zip")
+	writeZip(t, zipped, archiveInput[1:]) // zip archives have no root entry
+
+	for _, a := range []string{tgz, plain, zipped} {
+		if rep := verifyArchive(t, a, outDir, true); !rep.OK || rep.Archive != a {
+			t.Fatalf("%s: expected OK, got %+v", filepath.Base(a), rep)
+		}
+	}
+}
+
+func TestVerifyArchive_V7TarAndColonNames(t *testing.T) {
+	t.Parallel()
+	outDir := archivePack(t)
+	dir := t.TempDir()
+
+	// Old V7 tar archives have no "ustar" magic.
+	v7 := filepath.Join(dir, "evidence-v7.tar")
+	writeV7Tar(t, v7, archiveInput[1:])
+	if rep := verifyArchive(t, v7, outDir, true); !rep.OK {
+		t.Fatalf("v7 tar: expected OK, got %+v", rep.Problems)
+	}
+
+	// A colon is legal in a POSIX name; only a leading drive letter is not.
+	members := append(append([]member(nil), archiveInput...), member{name: "a:b.txt", body: "x\n"})
+	colon := filepath.Join(dir, "colon.tar")
+	writeTar(t, colon, false, members)
+	if rep := verifyArchive(t, colon, outDir, false); !rep.OK {
+		t.Fatalf("a:b member: expected OK, got %+v", rep.Problems)
+	}
+}
+
+func TestVerifyArchive_ReportsProblemsAndStrictExtras(t *testing.T) {
+	t.Parallel()
+	outDir := archivePack(t)
+
+	members := []member{
+		{name: "docs/a.txt", body: "ALPHA\n"},                    // modified (directory implied)
+		{name: "top.txt", body: "top, but longer\n"},             // size changed
+		{name: "link", typ: tar.TypeSymlink, link: "docs/a.txt"}, // retargeted
+		{name: "docs/new.txt", body: "new\n"},                    // extra
+	}
+	tgz := filepath.Join(t.TempDir(), "evidence.tgz")
+	writeTar(t, tgz, true, members)
+
+	want := []struct{ path, kind string }{
+		{"docs/a.txt", auditpack.ProblemModified},
+		{"docs/b.txt", auditpack.ProblemMissing},
+		{"link", auditpack.ProblemModified},
+		{"top.txt", auditpack.ProblemSizeChanged},
+		{"docs/new.txt", auditpack.ProblemExtra},
+	}
+	rep := verifyArchive(t, tgz, outDir, true)
+	if len(rep.Problems) != len(want) {
+		t.Fatalf("unexpected problems: %+v", rep.Problems)
+	}
+	for i, w := range want {
+		if got := rep.Problems[i]; got.Path != w.path || got.Kind != w.kind {
+			t.Fatalf("problem %d: got %+v want %s %s", i, got, w.path, w.kind)
+		}
+	}
+
+	// Without --strict the extra member is ignored.
+	if rep := verifyArchive(t, tgz, outDir, false); len(rep.Problems) != len(want)-1 {
+		t.Fatalf("unexpected non-strict problems: %+v", rep.Problems)
+	}
+}
+
+func TestVerifyArchive_RejectsUnsafeMemberNames(t *testing.T) {
+	t.Parallel()
+	outDir := archivePack(t)
+
+	members := append([]member(nil), archiveInput...)
+	members = append(members,
+		member{name: "../escape.txt", body: "x\n"},
+		member{name: "/etc/evil", body: "x\n"},
+		member{name: "docs/../../up.txt", body: "x\n"},
+		member{name: "C:/windows.txt", body: "x\n"},
+		member{name: "docs/a.txt", body: "alpha\n"}, // twice
+	)
+	tgz := filepath.Join(t.TempDir(), "evil.tar.gz")
+	writeTar(t, tgz, true, members)
+
+	rep := verifyArchive(t, tgz, outDir, true)
+	if rep.OK || rep.Counts[auditpack.ProblemUnsafePath] != 5 || len(rep.Problems) != 5 {
+		t.Fatalf("expected 5 unsafe_path problems, got %+v", rep.Problems)
+	}
+	if rep.Problems[0].Path != "../escape.txt" || !strings.Contains(rep.Problems[0].Message, "path traversal") {
+		t.Fatalf("unexpected first problem: %+v", rep.Problems[0])
+	}
+	if !errors.Is(rep.Err(), auditpack.ErrIntegrity) {
+		t.Fatalf("expected an integrity error, got %v", rep.Err())
+	}
+
+	// A member reached through a symlink member would be written through the
+	// link on extraction.
+	through := []member{
+		{name: "docs", typ: tar.TypeSymlink, link: "/tmp"},
+		{name: "docs/a.txt", body: "alpha\n"},
+		{name: "docs/b.txt", body: "bravo\n"},
+		{name: "top.txt", body: "top\n"},
+		{name: "link", typ: tar.TypeSymlink, link: "top.txt"},
+	}
+	tarPath := filepath.Join(t.TempDir(), "through.tar")
+	writeTar(t, tarPath, false, through)
+	rep = verifyArchive(t, tarPath, outDir, false)
+	if len(rep.Problems) != 2 || rep.Problems[0].Kind != auditpack.ProblemUnsafePath || rep.Problems[0].Actual != "docs" {
+		t.Fatalf("expected unsafe_path problems through docs, got %+v", rep.Problems)
+	}
+}
+
+func TestVerifyArchive_SystemTar(t *testing.T) {
+	tarBin, err := exec.LookPath("tar")
+	if err != nil {
+		t.Skip("tar not installed")
+	}
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "a", "one.txt"), []byte("one\n"))
+	mustWrite(t, filepath.Join(inDir, "two.txt"), []byte("two\n"))
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	tgz := filepath.Join(t.TempDir(), "evidence.tar.gz")
+	if out, err := exec.Command(tarBin, "-czf", tgz, "-C", inDir, ".").CombinedOutput(); err != nil {
+		t.Fatalf("tar: %v\n%s", err, out)
+	}
+	if rep := verifyArchive(t, tgz, outDir, true); !rep.OK {
+		t.Fatalf("expected OK, got %+v", rep.Problems)
+	}
+}
+
+func TestCLI_VerifyInArchive(t *testing.T) {
+	_, bin := buildAuditpackBinary(t)
+	outDir := archivePack(t)
+	tgz := filepath.Join(t.TempDir(), "evidence.tar.gz")
+	writeTar(t, tgz, true, archiveInput)
+
+	out, err := exec.Command(bin, "verify", "--pack", outDir, "--in-archive", tgz, "--strict").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "OK: input archive matches manifest.json") {
+		t.Fatalf("verify --in-archive: %v\n%s", err, out)
+	}
+
+	notArchive := filepath.Join(t.TempDir(), "notes.txt")
+	mustWrite(t, notArchive, []byte("not an archive\n"))
+	cmd := exec.Command(bin, "verify", "--pack", outDir, "--in-archive", notArchive)
+	var ee *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 2 {
+		t.Fatalf("expected exit 2 for a non-archive, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+func attestedPack(t *testing.T, inDir string) string {
+	t.Helper()
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Digests = []string{"sha256", "sha3-256"}
+	opts.RecordDirs = true
+	opts.Attest = true
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return outDir
+}
+
+func TestAttestation_SubjectsMatchManifest(t *testing.T) {
+	t.Parallel()
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "ledger.csv"), []byte("id,amount\n1,100\n"))
+	mustWrite(t, filepath.Join(inDir, "sub", "notes.txt"), []byte("reviewed\n"))
+	outDir := attestedPack(t, inDir)
+
+	data := mustRead(t, filepath.Join(outDir, auditpack.AttestationFile))
+	if again := mustRead(t, filepath.Join(attestedPack(t, inDir), auditpack.AttestationFile)); !bytes.Equal(data, again) {
+		t.Fatalf("attestation is not deterministic")
+	}
+	var st auditpack.Statement
+	if err := json.Unmarshal(data, &st); err != nil {
+		t.Fatalf("parse statement: %v", err)
+	}
+	if st.Type != auditpack.StatementType || st.PredicateType != auditpack.SLSAProvenanceType {
+		t.Fatalf("unexpected statement header: %q / %q", st.Type, st.PredicateType)
+	}
+	// The directory entry for sub/ has no digest, so it is not a subject.
+	if len(st.Subject) != 2 || st.Subject[0].Name != "ledger.csv" || st.Subject[1].Name != "sub/notes.txt" {
+		t.Fatalf("unexpected subjects: %+v", st.Subject)
+	}
+	if d := st.Subject[0].Digest; d["sha256"] == "" || d["sha3_256"] == "" || len(d) != 2 {
+		t.Fatalf("unexpected digest set: %v", d)
+	}
+	var prov auditpack.Provenance
+	if err := json.Unmarshal(st.Predicate, &prov); err != nil {
+		t.Fatalf("parse predicate: %v", err)
+	}
+	params := prov.BuildDefinition.ExternalParameters
+	if params.Input != "test/input" || !params.RecordDirs || params.Symlinks != "skip" ||
+		prov.RunDetails.Builder.Version["proof-first-auditpack"] != "dev" {
+		t.Fatalf("unexpected predicate: %+v", prov)
+	}
+
+	if n, err := auditpack.VerifyAttestation(context.Background(), outDir, data); err != nil || n != 2 {
+		t.Fatalf("verify attestation: %d, %v", n, err)
+	}
+
+	tampered := func(edit func(*auditpack.Statement)) []byte {
+		var s auditpack.Statement
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		edit(&s)
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	cases := map[string][]byte{
+		"changed digest":  tampered(func(s *auditpack.Statement) { s.Subject[0].Digest["sha256"] = "00" }),
+		"dropped digest":  tampered(func(s *auditpack.Statement) { delete(s.Subject[0].Digest, "sha3_256") }),
+		"extra digest":    tampered(func(s *auditpack.Statement) { s.Subject[0].Digest["sha512"] = "00" }),
+		"missing subject": tampered(func(s *auditpack.Statement) { s.Subject = s.Subject[:1] }),
+		"extra subject": tampered(func(s *auditpack.Statement) {
+			s.Subject = append(s.Subject, auditpack.Subject{Name: "sub", Digest: map[string]string{"sha256": "00"}})
+		}),
+		"duplicate subject": tampered(func(s *auditpack.Statement) { s.Subject = append(s.Subject, s.Subject[0]) }),
+		"wrong type":        tampered(func(s *auditpack.Statement) { s.Type = "https://in-toto.io/Statement/v0.1" }),
+	}
+	for name, b := range cases {
+		var ie *auditpack.IntegrityError
+		if _, err := auditpack.VerifyAttestation(context.Background(), outDir, b); !errors.As(err, &ie) || ie.Kind != auditpack.KindAttestationMismatch {
+			t.Errorf("%s: expected attestation_mismatch, got %v", name, err)
+		}
+	}
+
+	// Rebuilding without Attest removes the stale statement.
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, auditpack.AttestationFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected the attestation to be removed on rebuild, got %v", err)
+	}
+}
+
+func TestAttestation_SymlinksAreNotSubjects(t *testing.T) {
+	t.Parallel()
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "ledger.csv"), []byte("id,amount\n1,100\n"))
+	mustSymlink(t, "ledger.csv", filepath.Join(inDir, "latest.csv"))
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Symlinks = auditpack.SymlinksRecord
+	opts.Attest = true
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	data := mustRead(t, filepath.Join(outDir, auditpack.AttestationFile))
+	var st auditpack.Statement
+	if err := json.Unmarshal(data, &st); err != nil {
+		t.Fatalf("parse statement: %v", err)
+	}
+	// The symlink's digest is of its link text, not of ledger.csv.
+	if len(st.Subject) != 1 || st.Subject[0].Name != "ledger.csv" {
+		t.Fatalf("unexpected subjects: %+v", st.Subject)
+	}
+	if n, err := auditpack.VerifyAttestation(context.Background(), outDir, data); err != nil || n != 1 {
+		t.Fatalf("verify attestation: %d, %v", n, err)
+	}
+}
+
+func TestBuild_RebuildRemovesStaleSignatures(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "ledger.csv"), []byte("id,amount\n1,100\n"))
+	outDir := attestedPack(t, inDir)
+	pub, priv, err := signing.GenerateEd25519()
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	if err := auditpack.SignPack(ctx, outDir, priv); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := auditpack.AddSignOff(ctx, outDir, priv); err != nil {
+		t.Fatalf("sign-off: %v", err)
+	}
+	edS, _ := newDSSEKey(t, signing.AlgEd25519)
+	for _, what := range []string{auditpack.DSSEManifest, auditpack.DSSEAttestation} {
+		if _, err := auditpack.SignPackDSSE(ctx, outDir, what, []signing.Signer{edS}); err != nil {
+			t.Fatalf("sign %s: %v", what, err)
+		}
+	}
+	signed := []string{auditpack.SignatureFile, auditpack.SignaturesDir, auditpack.DSSEManifestFile, auditpack.DSSEAttestationFile}
+
+	// An identical rebuild leaves manifest.sha256 and the attestation as they
+	// were, so every signature still holds.
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Digests = []string{"sha256", "sha3-256"}
+	opts.RecordDirs = true
+	opts.Attest = true
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("identical rebuild: %v", err)
+	}
+	for _, name := range signed {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Fatalf("identical rebuild removed %s: %v", name, err)
+		}
+	}
+	if err := auditpack.VerifyPackSignature(ctx, outDir, pub); err != nil {
+		t.Fatalf("signature after identical rebuild: %v", err)
+	}
+
+	// A changed input invalidates them all; they are removed rather than
+	// left to fail verification.
+	mustWrite(t, filepath.Join(inDir, "ledger.csv"), []byte("id,amount\n1,999\n"))
+	var warnings []string
+	opts.Warn = func(msg string) { warnings = append(warnings, msg) }
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	for _, name := range signed {
+		if _, err := os.Stat(filepath.Join(outDir, name)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %s to be removed on rebuild, got %v", name, err)
+		}
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected one warning about removed signatures, got %q", warnings)
+	}
+	if err := auditpack.VerifyPackStrict(ctx, outDir); err != nil {
+		t.Fatalf("strict-pack after rebuild: %v", err)
+	}
+}
+
+func TestCLI_RunAttestAndVerify(t *testing.T) {
+	_, bin := buildAuditpackBinary(t)
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "ledger.csv"), []byte("id,amount\n1,100\n"))
+	outDir := filepath.Join(t.TempDir(), "out")
+	runCmdOK(t, bin, "run", "--in", inDir, "--out", outDir, "--label", "test/input", "--attest")
+
+	statement := filepath.Join(outDir, auditpack.AttestationFile)
+	runCmdOK(t, bin, "verify", "--pack", outDir, "--strict-pack", "--attestation", statement)
+
+	// An attestation for a different input tree does not match.
+	mustWrite(t, filepath.Join(inDir, "extra.csv"), []byte("id\n2\n"))
+	otherDir := filepath.Join(t.TempDir(), "other")
+	runCmdOK(t, bin, "run", "--in", inDir, "--out", otherDir, "--label", "test/input", "--attest")
+	cmd := exec.Command(bin, "verify", "--pack", outDir, "--attestation", filepath.Join(otherDir, auditpack.AttestationFile))
+	var ee *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 1 {
+		t.Fatalf("expected exit 1 for a mismatched attestation, got %v", err)
+	}
+}
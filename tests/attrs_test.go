@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+func TestBuild_CaptureModeAndMTime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX permission bits are not meaningful on Windows")
+	}
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+	aPath := filepath.Join(inDir, "a.txt")
+	mustWrite(t, aPath, []byte("alpha\n"))
+	if err := os.Chmod(aPath, 0o640); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	mtime := time.Date(2026, 9, 30, 17, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(aPath, mtime, mtime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Capture = []string{auditpack.AttrMTime, auditpack.AttrMode, auditpack.AttrUID, auditpack.AttrGID}
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	fe := m.Files[0]
+	if fe.Mode != "0640" || fe.MTime != "2026-09-30T17:00:00Z" || fe.UID == nil || fe.GID == nil {
+		t.Fatalf("unexpected captured metadata: %+v", fe)
+	}
+	var meta manifest.RunMeta
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "run_meta.json")), &meta); err != nil {
+		t.Fatalf("parse run_meta.json: %v", err)
+	}
+	if strings.Join(meta.Capture, ",") != "mode,mtime,uid,gid" {
+		t.Fatalf("run_meta capture not canonical: %v", meta.Capture)
+	}
+
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("verify pack: %v", err)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("verify input: %v", err)
+	}
+
+	// Touch the file: content is unchanged but mtime is enforced...
+	later := mtime.Add(time.Hour)
+	if err := os.Chtimes(aPath, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	err := auditpack.VerifyInput(inDir, outDir, false)
+	if err == nil || !strings.Contains(err.Error(), "mtime mismatch") {
+		t.Fatalf("expected mtime mismatch, got %v", err)
+	}
+	// ...unless it is ignored.
+	vopts := auditpack.VerifyOptions{IgnoreAttrs: []string{auditpack.AttrMTime}}
+	if err := auditpack.VerifyInputWith(inDir, outDir, vopts); err != nil {
+		t.Fatalf("verify ignoring mtime: %v", err)
+	}
+
+	// Mode is still enforced when only mtime is ignored.
+	if err := os.Chmod(aPath, 0o600); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	err = auditpack.VerifyInputWith(inDir, outDir, vopts)
+	if err == nil || !strings.Contains(err.Error(), "mode mismatch") {
+		t.Fatalf("expected mode mismatch, got %v", err)
+	}
+}
+
+func TestParseAttrs(t *testing.T) {
+	t.Parallel()
+
+	got, err := auditpack.ParseAttrs("gid, mode,mode")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if strings.Join(got, ",") != "mode,gid" {
+		t.Fatalf("unexpected attrs: %v", got)
+	}
+	if _, err := auditpack.ParseAttrs("mode,atime"); err == nil {
+		t.Fatalf("expected error for unknown attribute")
+	}
+}
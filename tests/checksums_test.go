@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/checksums"
+)
+
+const abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+func TestChecksums_ParseFormats(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		line string
+		want checksums.Entry
+	}{
+		{abcSHA256 + "  manifest.json", checksums.Entry{Sum: abcSHA256, Name: "manifest.json"}},
+		{abcSHA256 + " *manifest.json", checksums.Entry{Sum: abcSHA256, Name: "manifest.json", Binary: true}},
+		{abcSHA256 + "  my file  (v2).txt", checksums.Entry{Sum: abcSHA256, Name: "my file  (v2).txt"}},
+		{`\` + abcSHA256 + `  back\\slash\nnewline`, checksums.Entry{Sum: abcSHA256, Name: "back\\slash\nnewline"}},
+		{"SHA256 (manifest.json) = " + abcSHA256, checksums.Entry{Sum: abcSHA256, Name: "manifest.json", Tag: "SHA256"}},
+		{"SHA256 (odd) = name) = " + abcSHA256, checksums.Entry{Sum: abcSHA256, Name: "odd) = name", Tag: "SHA256"}},
+		{`\SHA256 (a\\b) = ` + abcSHA256, checksums.Entry{Sum: abcSHA256, Name: `a\b`, Tag: "SHA256"}},
+	}
+	for _, c := range cases {
+		got, err := checksums.ParseLine(c.line)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.line, err)
+		}
+		if got != c.want {
+			t.Fatalf("parse %q: got %+v want %+v", c.line, got, c.want)
+		}
+		if back := checksums.Format(got); back != c.line {
+			t.Fatalf("round trip: got %q want %q", back, c.line)
+		}
+	}
+
+	for _, bad := range []string{
+		"not-hex  file",
+		abcSHA256 + " file", // one space, no mode character
+		abcSHA256 + "  ",
+		"SHA256 (file) " + abcSHA256,
+		`\` + abcSHA256 + `  bad\qescape`,
+	} {
+		if _, err := checksums.ParseLine(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+
+	// Parse skips blanks and comments and tolerates CRLF; Write round-trips.
+	in := "# generated\r\n" + abcSHA256 + "  a b\r\n\r\nSHA256 (c) = " + abcSHA256 + "\r\n"
+	entries, err := checksums.Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := checksums.Write(&buf, entries); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	again, err := checksums.Parse(&buf)
+	if err != nil || !reflect.DeepEqual(again, entries) || len(entries) != 2 {
+		t.Fatalf("round trip through Write: %+v vs %+v (%v)", again, entries, err)
+	}
+}
+
+// TestVerifyPack_ChecksumsFromStandardTools regenerates manifest.sha256 with
+// sha256sum in its other output styles and checks the pack still verifies.
+func TestVerifyPack_ChecksumsFromStandardTools(t *testing.T) {
+	t.Parallel()
+
+	tool, err := exec.LookPath("sha256sum")
+	if err != nil {
+		t.Skip("sha256sum not available")
+	}
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	for _, flags := range [][]string{{"-b"}, {"--tag"}} {
+		outDir := t.TempDir()
+		opts := auditpack.DefaultOptions()
+		opts.InputLabel = "fixtures/input/case01"
+		if err := auditpack.Build(inDir, outDir, opts); err != nil {
+			t.Fatalf("build: %v", err)
+		}
+		cmd := exec.Command(tool, append(flags, "manifest.json", "run_meta.json")...)
+		cmd.Dir = outDir
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("sha256sum %v: %v", flags, err)
+		}
+		if err := os.WriteFile(filepath.Join(outDir, "manifest.sha256"), out, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := auditpack.VerifyPack(outDir); err != nil {
+			t.Fatalf("sha256sum %v output:\n%s\nverify pack: %v", flags, out, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+func TestBuildContext_CancelledWritesNothing(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	outDir := filepath.Join(t.TempDir(), "out")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "fixtures/input/case01"
+	err := auditpack.BuildContext(ctx, inDir, outDir, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Fatalf("cancelled build should not create outDir: %v", err)
+	}
+}
+
+func TestVerifyInputContext_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "fixtures/input/case01"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := auditpack.VerifyPackContext(ctx, outDir); !errors.Is(err, context.Canceled) {
+		t.Fatalf("verify pack: expected context.Canceled, got %v", err)
+	}
+	err := auditpack.VerifyInputContext(ctx, inDir, outDir, auditpack.VerifyOptions{Strict: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("verify input: expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBuild_ProgressReportsTotals(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	var want int64
+	for i := 0; i < 6; i++ {
+		data := []byte(strings.Repeat("x", 1000*(i+1)))
+		want += int64(len(data))
+		mustWrite(t, filepath.Join(inDir, fmt.Sprintf("f%d.bin", i)), data)
+	}
+
+	var last auditpack.Progress
+	calls := 0
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Jobs = 3
+	opts.Progress = func(p auditpack.Progress) {
+		calls++
+		if p.FilesDone < last.FilesDone || p.BytesDone < last.BytesDone {
+			t.Errorf("progress went backwards: %+v after %+v", p, last)
+		}
+		last = p
+	}
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if calls == 0 {
+		t.Fatalf("progress callback never called")
+	}
+	if last.Phase != "build" || last.FilesDone != 6 || last.FilesTotal != 6 || last.BytesDone != want || last.BytesTotal != want {
+		t.Fatalf("unexpected final progress: %+v (want %d bytes)", last, want)
+	}
+
+	last = auditpack.Progress{}
+	vopts := auditpack.VerifyOptions{Progress: func(p auditpack.Progress) { last = p }}
+	if err := auditpack.VerifyInputWith(inDir, outDir, vopts); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if last.Phase != "verify" || last.FilesDone != 6 || last.BytesDone != want {
+		t.Fatalf("unexpected final verify progress: %+v", last)
+	}
+}
+
+func TestRemoveTempFiles_KeepsOtherWriters(t *testing.T) {
+	t.Parallel()
+
+	// A temp file this process did not create may belong to a concurrent
+	// writer (a signer working on the same pack), so it is left alone.
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "manifest.sha256.sig.tmp-123"), []byte("partial"))
+	mustWrite(t, filepath.Join(dir, "manifest.json"), []byte("{}\n"))
+
+	if err := auditpack.RemoveTempFiles(dir); err != nil {
+		t.Fatalf("remove temp files: %v", err)
+	}
+	for _, name := range []string{"manifest.sha256.sig.tmp-123", "manifest.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s removed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+func TestHashing_KnownVectors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		alg, in, want string
+	}{
+		{hashing.SHA256, "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{hashing.SHA512, "abc", "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{hashing.SHA3_256, "", "a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a"},
+		{hashing.SHA3_256, "abc", "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+		// 200 bytes spans more than one 136-byte SHA3-256 block.
+		{hashing.SHA3_256, strings.Repeat("\xa3", 200), "79f38adec5c20307a98ef76e8324afbfd46cfd81b22e3973c65fa1bd9de31787"},
+	}
+	for _, c := range cases {
+		got, err := hashing.HashBytes([]byte(c.in), []string{c.alg})
+		if err != nil {
+			t.Fatalf("%s: %v", c.alg, err)
+		}
+		if got[c.alg] != c.want {
+			t.Errorf("%s(%q...): got %s want %s", c.alg, c.in[:min(len(c.in), 8)], got[c.alg], c.want)
+		}
+	}
+
+	if _, err := hashing.ParseNames("sha256,md5"); err == nil {
+		t.Fatalf("expected error for unknown algorithm")
+	}
+}
+
+func TestBuild_MultipleDigests(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	outDir := t.TempDir()
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "fixtures/input/case01"
+	opts.Digests = []string{hashing.SHA3_256, hashing.SHA512}
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	for _, fe := range m.Files {
+		if fe.SHA256 != "" || len(fe.Digests) != 2 || fe.Digests[hashing.SHA512] == "" || fe.Digests[hashing.SHA3_256] == "" {
+			t.Fatalf("unexpected digests for %s: %+v", fe.Path, fe)
+		}
+	}
+
+	// The pack checksum files follow the chosen algorithms.
+	for _, name := range []string{"manifest.sha512", "manifest.sha3-256"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "manifest.sha256")); !os.IsNotExist(err) {
+		t.Fatalf("manifest.sha256 should not be written when sha256 is not selected: %v", err)
+	}
+
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("verify pack: %v", err)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("verify input: %v", err)
+	}
+
+	// Every digest run_meta.json records needs its checksum file.
+	shaPath := filepath.Join(outDir, "manifest.sha512")
+	sha := mustRead(t, shaPath)
+	if err := os.Remove(shaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditpack.VerifyPack(outDir); err == nil || !strings.Contains(err.Error(), "missing manifest.sha512") {
+		t.Fatalf("expected missing manifest.sha512, got %v", err)
+	}
+	mustWrite(t, shaPath, sha)
+
+	// Tampering with manifest.json is caught by every checksum file.
+	manPath := filepath.Join(outDir, "manifest.json")
+	orig := mustRead(t, manPath)
+	if err := os.WriteFile(manPath, append(orig, ' '), 0o644); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	err := auditpack.VerifyPack(outDir)
+	if err == nil || !strings.Contains(err.Error(), "sha512 mismatch for manifest.json") {
+		t.Fatalf("expected sha512 mismatch, got %v", err)
+	}
+}
+
+func TestBuild_DigestSwitchRemovesStaleChecksums(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	outDir := t.TempDir()
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "fixtures/input/case01"
+	opts.Digests = []string{hashing.SHA512}
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	// Rebuilding with the default digest must leave a pack identical to the golden one.
+	opts.Digests = nil
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "manifest.sha512")); !os.IsNotExist(err) {
+		t.Fatalf("stale manifest.sha512 left behind: %v", err)
+	}
+	expSHA := mustRead(t, filepath.Join("..", "fixtures", "expected", "case01", "manifest.sha256"))
+	if string(mustRead(t, filepath.Join(outDir, "manifest.sha256"))) != string(expSHA) {
+		t.Fatalf("manifest.sha256 mismatch after rebuild")
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+func TestBuild_RecordDirs(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	mustWrite(t, filepath.Join(inDir, "nested", "b.txt"), []byte("bravo\n"))
+	if err := os.MkdirAll(filepath.Join(inDir, "approvals"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+
+	// Without --record-dirs the empty folder leaves no trace.
+	plain := t.TempDir()
+	if err := auditpack.Build(inDir, plain, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if got := manifestPaths(t, plain); !reflect.DeepEqual(got, []string{"a.txt", "nested/b.txt"}) {
+		t.Fatalf("unexpected paths without record-dirs: %v", got)
+	}
+
+	opts.RecordDirs = true
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	want := []string{"a.txt", "approvals", "nested", "nested/b.txt"}
+	if got := manifestPaths(t, outDir); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected paths with record-dirs:\n got %v\nwant %v", got, want)
+	}
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("verify pack: %v", err)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("strict verify: %v", err)
+	}
+
+	// Removing the empty folder is now a verification failure.
+	if err := os.Remove(filepath.Join(inDir, "approvals")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	err := auditpack.VerifyInput(inDir, outDir, false)
+	if err == nil || !strings.Contains(err.Error(), `missing directory "approvals"`) {
+		t.Fatalf("expected missing directory failure, got %v", err)
+	}
+
+	// Adding a new empty folder is caught by --strict.
+	if err := os.MkdirAll(filepath.Join(inDir, "approvals"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(inDir, "drafts"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	err = auditpack.VerifyInput(inDir, outDir, true)
+	if err == nil || !strings.Contains(err.Error(), `extra input directory not in manifest: "drafts"`) {
+		t.Fatalf("expected extra directory failure, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+func newDSSEKey(t *testing.T, alg string) (signing.Signer, signing.Verifier) {
+	t.Helper()
+	key, err := signing.GenerateKey(alg)
+	if err != nil {
+		t.Fatalf("generate %s key: %v", alg, err)
+	}
+	s, err := signing.NewSigner(key)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	v, err := signing.NewVerifier(key.Public())
+	if err != nil {
+		t.Fatalf("verifier: %v", err)
+	}
+	return s, v
+}
+
+func TestDSSE_PAE(t *testing.T) {
+	t.Parallel()
+	// Test vector from the DSSE protocol specification.
+	got := string(signing.PAE("http://example.com/HelloWorld", []byte("hello world")))
+	if want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"; got != want {
+		t.Fatalf("PAE = %q, want %q", got, want)
+	}
+}
+
+func TestDSSE_EnvelopeMultipleSigners(t *testing.T) {
+	t.Parallel()
+	edS, edV := newDSSEKey(t, signing.AlgEd25519)
+	ecS, ecV := newDSSEKey(t, signing.AlgECDSAP256)
+	_, otherV := newDSSEKey(t, signing.AlgECDSAP256)
+
+	env := signing.NewEnvelope("text/plain", []byte("payload"))
+	for _, s := range []signing.Signer{edS, ecS} {
+		if err := env.Sign(s); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+	if err := env.Sign(edS); err == nil {
+		t.Fatalf("expected a second signature by the same key to be refused")
+	}
+	checks, err := env.Check([]signing.Verifier{edV, ecV, otherV})
+	if err != nil || len(checks) != 2 || !checks[0].Valid || !checks[1].Valid {
+		t.Fatalf("expected two valid signatures, got %+v, %v", checks, err)
+	}
+
+	// The signature covers the payload type as well as the payload.
+	env.PayloadType = "application/json"
+	checks, _ = env.Check([]signing.Verifier{edV, ecV})
+	for _, c := range checks {
+		if c.Valid {
+			t.Fatalf("signature survived a payloadType change: %+v", c)
+		}
+	}
+}
+
+func TestSignPackDSSE_ManifestAndAttestation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "ledger.csv"), []byte("id,amount\n1,100\n"))
+	outDir := attestedPack(t, inDir)
+	edS, edV := newDSSEKey(t, signing.AlgEd25519)
+	ecS, ecV := newDSSEKey(t, signing.AlgECDSAP256)
+
+	if _, err := auditpack.SignPackDSSE(ctx, outDir, auditpack.DSSEManifest, []signing.Signer{edS}); err != nil {
+		t.Fatalf("sign manifest: %v", err)
+	}
+	// A second signer is added to the same envelope.
+	if _, err := auditpack.SignPackDSSE(ctx, outDir, auditpack.DSSEManifest, []signing.Signer{ecS}); err != nil {
+		t.Fatalf("add signature: %v", err)
+	}
+	if _, err := auditpack.SignPackDSSE(ctx, outDir, auditpack.DSSEAttestation, []signing.Signer{ecS}); err != nil {
+		t.Fatalf("sign attestation: %v", err)
+	}
+	if err := auditpack.VerifyPackStrict(ctx, outDir); err != nil {
+		t.Fatalf("strict-pack with DSSE envelopes: %v", err)
+	}
+
+	manEnv := mustRead(t, filepath.Join(outDir, auditpack.DSSEManifestFile))
+	rep, err := auditpack.VerifyPackDSSE(ctx, outDir, manEnv, []signing.Verifier{edV, ecV})
+	if err != nil || rep.PayloadType != auditpack.PayloadTypeChecksums || len(rep.Signatures) != 2 {
+		t.Fatalf("verify manifest envelope: %+v, %v", rep, err)
+	}
+	attEnv := mustRead(t, filepath.Join(outDir, auditpack.DSSEAttestationFile))
+	if _, err := auditpack.VerifyPackDSSE(ctx, outDir, attEnv, []signing.Verifier{ecV}); err != nil {
+		t.Fatalf("verify attestation envelope: %v", err)
+	}
+	var ie *auditpack.IntegrityError
+	if _, err := auditpack.VerifyPackDSSE(ctx, outDir, attEnv, []signing.Verifier{edV}); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureMissing {
+		t.Fatalf("expected signature_missing for a key that did not sign, got %v", err)
+	}
+
+	// A forged signature value is invalid.
+	var env signing.Envelope
+	if err := json.Unmarshal(manEnv, &env); err != nil {
+		t.Fatal(err)
+	}
+	env.Signatures[0].Sig = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 64))
+	forged, _ := env.Marshal()
+	if _, err := auditpack.VerifyPackDSSE(ctx, outDir, forged, []signing.Verifier{edV}); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureInvalid {
+		t.Fatalf("expected signature_invalid for a forged signature, got %v", err)
+	}
+
+	// A key is satisfied by any one valid signature, even after an invalid
+	// entry with the same keyid.
+	if err := json.Unmarshal(manEnv, &env); err != nil {
+		t.Fatal(err)
+	}
+	good := env.Signatures[0]
+	env.Signatures[0].Sig = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 64))
+	env.Signatures = append(env.Signatures, good)
+	dup, _ := env.Marshal()
+	if _, err := auditpack.VerifyPackDSSE(ctx, outDir, dup, []signing.Verifier{edV}); err != nil {
+		t.Fatalf("verify with an invalid and a valid signature by one key: %v", err)
+	}
+
+	// The keyid is only a hint: a signature without one is tried against
+	// every given key.
+	if err := json.Unmarshal(manEnv, &env); err != nil {
+		t.Fatal(err)
+	}
+	for i := range env.Signatures {
+		env.Signatures[i].KeyID = ""
+	}
+	anon, _ := env.Marshal()
+	rep, err = auditpack.VerifyPackDSSE(ctx, outDir, anon, []signing.Verifier{edV, ecV})
+	if err != nil {
+		t.Fatalf("verify without keyids: %v", err)
+	}
+	for _, c := range rep.Signatures {
+		if !c.Valid || c.VerifiedBy == "" {
+			t.Fatalf("expected every signature to be matched to a key: %+v", rep.Signatures)
+		}
+	}
+
+	// Once the pack changes, the envelope no longer belongs to it, and signing
+	// again refuses to mix payloads.
+	outDir = signedTestPack(t)
+	if _, err := auditpack.SignPackDSSE(ctx, outDir, auditpack.DSSEManifest, []signing.Signer{edS}); err != nil {
+		t.Fatalf("sign manifest: %v", err)
+	}
+	manEnv = mustRead(t, filepath.Join(outDir, auditpack.DSSEManifestFile))
+	manPath := filepath.Join(outDir, "manifest.json")
+	mustWrite(t, manPath, bytes.Replace(mustRead(t, manPath), []byte(`"test/input"`), []byte(`"forged/input"`), 1))
+	metaPath := filepath.Join(outDir, "run_meta.json")
+	mustWrite(t, metaPath, bytes.Replace(mustRead(t, metaPath), []byte(`"test/input"`), []byte(`"forged/input"`), 1))
+	resealPack(t, outDir)
+	if _, err := auditpack.VerifyPackDSSE(ctx, outDir, manEnv, []signing.Verifier{edV}); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureInvalid {
+		t.Fatalf("expected signature_invalid for a stale envelope, got %v", err)
+	}
+	if _, err := auditpack.SignPackDSSE(ctx, outDir, auditpack.DSSEManifest, []signing.Signer{edS}); err == nil ||
+		!strings.Contains(err.Error(), "earlier version") {
+		t.Fatalf("expected signing over a stale envelope to fail, got %v", err)
+	}
+}
+
+func TestSignPackDSSE_OpenSSLInterop(t *testing.T) {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not installed")
+	}
+	t.Parallel()
+	outDir := signedTestPack(t)
+	dir := t.TempDir()
+
+	for _, alg := range []struct{ name, genpkey, opt string }{
+		{"ed25519", "ed25519", ""},
+		{"ecdsa-p256", "EC", "ec_paramgen_curve:P-256"},
+	} {
+		keyPath := filepath.Join(dir, alg.name+".key")
+		args := []string{"genpkey", "-algorithm", alg.genpkey, "-out", keyPath}
+		if alg.opt != "" {
+			args = append(args, "-pkeyopt", alg.opt)
+		}
+		if out, err := exec.Command(openssl, args...).CombinedOutput(); err != nil {
+			t.Skipf("openssl genpkey %s: %v\n%s", alg.name, err, out)
+		}
+		pubPath := filepath.Join(dir, alg.name+".pub")
+		if out, err := exec.Command(openssl, "pkey", "-in", keyPath, "-pubout", "-out", pubPath).CombinedOutput(); err != nil {
+			t.Fatalf("openssl pkey: %v\n%s", err, out)
+		}
+		key, err := signing.ParsePrivateKey(mustRead(t, keyPath))
+		if err != nil {
+			t.Fatalf("parse openssl %s key: %v", alg.name, err)
+		}
+		s, err := signing.NewSigner(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := auditpack.SignPackDSSE(context.Background(), outDir, auditpack.DSSEManifest, []signing.Signer{s}); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+
+	// OpenSSL checks each signature over the PAE of the payload.
+	env, payload, err := signing.ParseEnvelope(mustRead(t, filepath.Join(outDir, auditpack.DSSEManifestFile)))
+	if err != nil {
+		t.Fatalf("parse envelope: %v", err)
+	}
+	paePath := filepath.Join(dir, "pae.bin")
+	mustWrite(t, paePath, signing.PAE(env.PayloadType, payload))
+	for i, alg := range []string{"ed25519", "ecdsa-p256"} {
+		sig, _ := base64.StdEncoding.DecodeString(env.Signatures[i].Sig)
+		sigPath := filepath.Join(dir, alg+".sig")
+		mustWrite(t, sigPath, sig)
+		pubPath := filepath.Join(dir, alg+".pub")
+		var cmd *exec.Cmd
+		if alg == "ed25519" {
+			cmd = exec.Command(openssl, "pkeyutl", "-verify", "-pubin", "-inkey", pubPath, "-rawin", "-in", paePath, "-sigfile", sigPath)
+		} else {
+			cmd = exec.Command(openssl, "dgst", "-sha256", "-verify", pubPath, "-signature", sigPath, paePath)
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("openssl verify %s: %v\n%s", alg, err, out)
+		}
+	}
+}
+
+func TestCLI_SignVerifyDSSE(t *testing.T) {
+	_, bin := buildAuditpackBinary(t)
+	outDir := signedTestPack(t)
+	keys := t.TempDir()
+	ed, ec := filepath.Join(keys, "ed"), filepath.Join(keys, "ec")
+	runCmdOK(t, bin, "keygen", "--out", ed)
+	runCmdOK(t, bin, "keygen", "--out", ec, "--alg", "ecdsa-p256")
+
+	runCmdOK(t, bin, "sign", "--pack", outDir, "--dsse", "manifest", "--key", ed+".key", "--key", ec+".key")
+	envPath := filepath.Join(outDir, auditpack.DSSEManifestFile)
+	out, err := exec.Command(bin, "verify", "--pack", outDir, "--strict-pack", "--dsse", envPath,
+		"--dsse-key", ed+".pub", "--dsse-key", ec+".pub").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "signatures: 2") || !strings.Contains(string(out), "matches the pack") {
+		t.Fatalf("verify --dsse: %v\n%s", err, out)
+	}
+
+	other := filepath.Join(keys, "other")
+	runCmdOK(t, bin, "keygen", "--out", other, "--alg", "ecdsa-p256")
+	var ee *exec.ExitError
+	cmd := exec.Command(bin, "verify", "--pack", outDir, "--dsse", envPath, "--dsse-key", other+".pub")
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 1 {
+		t.Fatalf("expected exit 1 for a key that did not sign, got %v", err)
+	}
+	// ECDSA keys only sign DSSE envelopes.
+	cmd = exec.Command(bin, "sign", "--pack", outDir, "--key", ec+".key")
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 2 {
+		t.Fatalf("expected exit 2 for an ECDSA key without --dsse, got %v", err)
+	}
+	// Attestation envelopes need a pack built with --attest.
+	cmd = exec.Command(bin, "sign", "--pack", outDir, "--dsse", "attestation", "--key", ed+".key")
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("expected signing a missing attestation to fail")
+	}
+}
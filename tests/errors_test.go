@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+func TestErrors_Classes(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+
+	bad := opts
+	bad.Symlinks = "sometimes"
+	err := auditpack.Build(inDir, outDir, bad)
+	var ue *auditpack.UsageError
+	if !errors.Is(err, auditpack.ErrUsage) || !errors.As(err, &ue) {
+		t.Fatalf("expected a usage error, got %T %v", err, err)
+	}
+
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("ALPHA\n"))
+	err = auditpack.VerifyInput(inDir, outDir, false)
+	var ie *auditpack.IntegrityError
+	if !errors.Is(err, auditpack.ErrIntegrity) || !errors.As(err, &ie) || ie.Path != "a.txt" || ie.Kind != auditpack.ProblemModified {
+		t.Fatalf("expected an integrity error for a.txt, got %T %v", err, err)
+	}
+
+	manPath := filepath.Join(outDir, "manifest.json")
+	if err := os.WriteFile(manPath, append(mustRead(t, manPath), ' '), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = auditpack.VerifyPack(outDir)
+	if !errors.As(err, &ie) || ie.Kind != auditpack.KindChecksumMismatch || ie.Path != "manifest.json" {
+		t.Fatalf("expected a checksum mismatch, got %T %v", err, err)
+	}
+
+	err = auditpack.VerifyPack(filepath.Join(outDir, "nope"))
+	var mc *auditpack.MissingChecksumError
+	if !auditpack.IsIOError(err) || errors.Is(err, auditpack.ErrIntegrity) || !errors.As(err, &mc) {
+		t.Fatalf("expected an I/O error for a missing pack, got %T %v", err, err)
+	}
+
+	mustSymlink(t, "a.txt", filepath.Join(inDir, "link"))
+	strict := opts
+	strict.Symlinks = auditpack.SymlinksError
+	err = auditpack.Build(inDir, t.TempDir(), strict)
+	var pe *auditpack.PolicyError
+	if !errors.Is(err, auditpack.ErrPolicy) || !errors.As(err, &pe) || pe.Path != "link" || pe.Policy != "--symlinks=error" {
+		t.Fatalf("expected a policy error for link, got %T %v", err, err)
+	}
+}
+
+func TestCLI_ExitCodesAndStderr(t *testing.T) {
+	repoRoot, bin := buildAuditpackBinary(t)
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	outDir := filepath.Join(t.TempDir(), "out")
+	runCmdOK(t, bin, "run", "--in", inDir, "--out", outDir)
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("ALPHA\n"))
+	linkDir := filepath.Join(t.TempDir(), "links")
+	mustWrite(t, filepath.Join(linkDir, "a.txt"), []byte("alpha\n"))
+	mustSymlink(t, "a.txt", filepath.Join(linkDir, "link"))
+
+	cases := []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"verify", "--pack", outDir, "--in", inDir}, 1, `sha256 mismatch for "a.txt"`},
+		{[]string{"run", "--in", inDir, "--out", outDir, "--symlinks", "sometimes"}, 2, "invalid symlink policy"},
+		{[]string{"frobnicate"}, 2, "Unknown command"},
+		{[]string{"verify", "--pack", filepath.Join(repoRoot, "does-not-exist")}, 3, "no pack checksum file"},
+		{[]string{"run", "--in", linkDir, "--out", t.TempDir(), "--symlinks", "error"}, 5, "symlink not allowed"},
+	}
+	for _, c := range cases {
+		cmd := exec.Command(bin, c.args...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err := cmd.Run()
+		var ee *exec.ExitError
+		if !errors.As(err, &ee) || ee.ExitCode() != c.code {
+			t.Fatalf("%v: expected exit %d, got %v\nstdout:\n%s\nstderr:\n%s", c.args, c.code, err, stdout.String(), stderr.String())
+		}
+		if !strings.Contains(stderr.String(), c.stderr) || strings.Contains(stdout.String(), c.stderr) {
+			t.Fatalf("%v: expected %q on stderr only\nstdout:\n%s\nstderr:\n%s", c.args, c.stderr, stdout.String(), stderr.String())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/pathfilter"
+)
+
+func manifestPaths(t *testing.T, outDir string) []string {
+	t.Helper()
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	out := make([]string, 0, len(m.Files))
+	for _, fe := range m.Files {
+		out = append(out, fe.Path)
+	}
+	return out
+}
+
+func TestPathfilter_Match(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.txt", "a.txt", true},
+		{"*.txt", "dir/a.txt", false},
+		{"**/*.txt", "a.txt", true},
+		{"**/*.txt", "dir/sub/a.txt", true},
+		{"invoices/**", "invoices/2026-09/a.pdf", true},
+		{"invoices/**", "other/a.pdf", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+	}
+	for _, c := range cases {
+		if got := pathfilter.Match(c.pattern, c.name); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestBuild_IgnoreFileAndExcludeFlags(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	mustWrite(t, filepath.Join(inDir, "keep.swp"), []byte("kept by negation\n"))
+	mustWrite(t, filepath.Join(inDir, "b.swp"), []byte("swap\n"))
+	mustWrite(t, filepath.Join(inDir, ".git", "HEAD"), []byte("ref\n"))
+	mustWrite(t, filepath.Join(inDir, "pkg", "__pycache__", "x.pyc"), []byte("pyc\n"))
+	mustWrite(t, filepath.Join(inDir, "pkg", "mod.py"), []byte("print(1)\n"))
+	mustWrite(t, filepath.Join(inDir, "pkg", "Thumbs.db"), []byte("thumbs\n"))
+	mustWrite(t, filepath.Join(inDir, pathfilter.IgnoreFileName), []byte("# editor junk\n*.swp\n!keep.swp\n__pycache__/\n\n.git/\n"))
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Exclude = []string{"Thumbs.db"}
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	want := []string{".auditpackignore", "a.txt", "keep.swp", "pkg/mod.py"}
+	if got := manifestPaths(t, outDir); !reflect.DeepEqual(got, want) {
+		t.Fatalf("manifest paths mismatch:\n got %v\nwant %v", got, want)
+	}
+
+	var meta manifest.RunMeta
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "run_meta.json")), &meta); err != nil {
+		t.Fatalf("parse run_meta.json: %v", err)
+	}
+	if meta.Filter == nil {
+		t.Fatalf("run_meta.json missing filter")
+	}
+	if !reflect.DeepEqual(meta.Filter.Exclude, []string{"Thumbs.db"}) {
+		t.Fatalf("run_meta exclude mismatch: %v", meta.Filter.Exclude)
+	}
+	if !reflect.DeepEqual(meta.Filter.Ignore, []string{"*.swp", "!keep.swp", "__pycache__/", ".git/"}) {
+		t.Fatalf("run_meta ignore mismatch: %v", meta.Filter.Ignore)
+	}
+
+	// Strict verification applies the recorded filter, so excluded files are not extras.
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("strict verify: %v", err)
+	}
+
+	// A new file that is not filtered out is still an extra.
+	mustWrite(t, filepath.Join(inDir, "pkg", "new.py"), []byte("new\n"))
+	if err := auditpack.VerifyInput(inDir, outDir, true); err == nil {
+		t.Fatalf("expected strict failure for new unfiltered file")
+	}
+	if err := os.Remove(filepath.Join(inDir, "pkg", "new.py")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+}
+
+func TestBuild_IncludeFlag(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-09", "a.pdf"), []byte("a\n"))
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-10", "b.pdf"), []byte("b\n"))
+	mustWrite(t, filepath.Join(inDir, "notes.txt"), []byte("n\n"))
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Include = []string{"invoices/**/*.pdf"}
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	want := []string{"invoices/2026-09/a.pdf", "invoices/2026-10/b.pdf"}
+	if got := manifestPaths(t, outDir); !reflect.DeepEqual(got, want) {
+		t.Fatalf("manifest paths mismatch:\n got %v\nwant %v", got, want)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("strict verify: %v", err)
+	}
+}
+
+func TestBuild_IncludeFlagWithRecordDirs(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-09", "a.pdf"), []byte("a\n"))
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-10", "b.txt"), []byte("b\n"))
+	mustWrite(t, filepath.Join(inDir, "scratch", "tmp", "c.txt"), []byte("c\n"))
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Include = []string{"invoices/**"}
+	opts.RecordDirs = true
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	// Directories outside the include patterns are walked but not recorded.
+	want := []string{"invoices", "invoices/2026-09", "invoices/2026-09/a.pdf", "invoices/2026-10", "invoices/2026-10/b.txt"}
+	if got := manifestPaths(t, outDir); !reflect.DeepEqual(got, want) {
+		t.Fatalf("manifest paths mismatch:\n got %v\nwant %v", got, want)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("strict verify: %v", err)
+	}
+
+	// An include pattern that only matches files records no directories.
+	outDir = t.TempDir()
+	opts.Include = []string{"**/*.pdf"}
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if got := manifestPaths(t, outDir); !reflect.DeepEqual(got, []string{"invoices/2026-09/a.pdf"}) {
+		t.Fatalf("manifest paths mismatch: got %v", got)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("strict verify: %v", err)
+	}
+}
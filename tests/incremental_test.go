@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+func readRunMeta(t *testing.T, outDir string) manifest.RunMeta {
+	t.Helper()
+	var meta manifest.RunMeta
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "run_meta.json")), &meta); err != nil {
+		t.Fatalf("parse run_meta.json: %v", err)
+	}
+	return meta
+}
+
+func TestBuild_BaselineReusesUnchangedFiles(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("inode/ctime reuse is only implemented on linux and darwin")
+	}
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	for i := 0; i < 5; i++ {
+		mustWrite(t, filepath.Join(inDir, fmt.Sprintf("f%d.txt", i)), []byte(fmt.Sprintf("file %d\n", i)))
+	}
+	// Files touched right before a build are never cached (racy timestamps).
+	time.Sleep(2100 * time.Millisecond)
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.StatCache = true
+	base := t.TempDir()
+	if err := auditpack.Build(inDir, base, opts); err != nil {
+		t.Fatalf("baseline build: %v", err)
+	}
+
+	mustWrite(t, filepath.Join(inDir, "f2.txt"), []byte("changed\n"))
+
+	opts.StatCache = false
+	opts.Baseline = base
+	incr := t.TempDir()
+	if err := auditpack.Build(inDir, incr, opts); err != nil {
+		t.Fatalf("incremental build: %v", err)
+	}
+	inc := readRunMeta(t, incr).Incremental
+	if inc == nil || inc.Reused != 4 || inc.Rehashed != 1 {
+		t.Fatalf("unexpected incremental counts: %+v", inc)
+	}
+
+	full := t.TempDir()
+	fullOpts := auditpack.DefaultOptions()
+	fullOpts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, full, fullOpts); err != nil {
+		t.Fatalf("full build: %v", err)
+	}
+	if string(mustRead(t, filepath.Join(incr, "manifest.json"))) != string(mustRead(t, filepath.Join(full, "manifest.json"))) {
+		t.Fatalf("incremental manifest.json differs from a full rebuild")
+	}
+	if err := auditpack.VerifyInput(inDir, incr, true); err != nil {
+		t.Fatalf("verify input: %v", err)
+	}
+
+	// --paranoid re-hashes everything.
+	opts.Paranoid = true
+	para := t.TempDir()
+	if err := auditpack.Build(inDir, para, opts); err != nil {
+		t.Fatalf("paranoid build: %v", err)
+	}
+	inc = readRunMeta(t, para).Incremental
+	if inc == nil || inc.Reused != 0 || inc.Rehashed != 5 || !inc.Paranoid {
+		t.Fatalf("unexpected paranoid counts: %+v", inc)
+	}
+}
+
+func TestBuild_BaselineWithoutStatCacheRehashes(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "fixtures/input/case01"
+	base := t.TempDir()
+	if err := auditpack.Build(inDir, base, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	var warnings []string
+	opts.Baseline = base
+	opts.Warn = func(msg string) { warnings = append(warnings, msg) }
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build with a baseline without stat cache: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "stat_cache.json") {
+		t.Fatalf("expected one stat cache warning, got %q", warnings)
+	}
+	if inc := readRunMeta(t, outDir).Incremental; inc == nil || inc.Reused != 0 || inc.Rehashed == 0 {
+		t.Fatalf("unexpected incremental counts: %+v", inc)
+	}
+}
+
+func TestBuild_BaselineStatCacheIsCovered(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "fixtures/input/case01"
+	opts.StatCache = true
+	base := t.TempDir()
+	if err := auditpack.Build(inDir, base, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if !strings.Contains(string(mustRead(t, filepath.Join(base, "manifest.sha256"))), "  stat_cache.json\n") {
+		t.Fatalf("manifest.sha256 does not cover stat_cache.json")
+	}
+	if err := auditpack.VerifyPackStrict(context.Background(), base); err != nil {
+		t.Fatalf("strict-pack: %v", err)
+	}
+
+	opts.Baseline = base
+	// An edited cache no longer matches manifest.sha256.
+	cachePath := filepath.Join(base, "stat_cache.json")
+	cache := mustRead(t, cachePath)
+	mustWrite(t, cachePath, append(cache, ' '))
+	err := auditpack.Build(inDir, t.TempDir(), opts)
+	if err == nil || !strings.Contains(err.Error(), "mismatch for stat_cache.json") {
+		t.Fatalf("expected a stat cache checksum mismatch, got %v", err)
+	}
+	mustWrite(t, cachePath, cache)
+
+	// A cache the checksum files do not list is refused.
+	shaPath := filepath.Join(base, "manifest.sha256")
+	var kept []string
+	for _, ln := range strings.Split(strings.TrimSpace(string(mustRead(t, shaPath))), "\n") {
+		if !strings.HasSuffix(ln, "stat_cache.json") {
+			kept = append(kept, ln)
+		}
+	}
+	mustWrite(t, shaPath, []byte(strings.Join(kept, "\n")+"\n"))
+	err = auditpack.Build(inDir, t.TempDir(), opts)
+	if err == nil || !strings.Contains(err.Error(), "stat_cache.json is not covered by manifest.sha256") {
+		t.Fatalf("expected an uncovered stat cache to be refused, got %v", err)
+	}
+}
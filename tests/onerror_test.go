@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// vanishingInput returns an input tree and build options whose progress
+// callback deletes gone.txt just before it is hashed, which makes that file
+// unreadable deterministically (even when the tests run as root).
+func vanishingInput(t *testing.T) (string, auditpack.Options) {
+	t.Helper()
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("a\n"))
+	mustWrite(t, filepath.Join(inDir, "gone.txt"), []byte("soon gone\n"))
+	mustWrite(t, filepath.Join(inDir, "z.txt"), []byte("z\n"))
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Jobs = 1
+	opts.Progress = func(p auditpack.Progress) {
+		if p.Path == "gone.txt" {
+			_ = os.Remove(filepath.Join(inDir, "gone.txt"))
+		}
+	}
+	return inDir, opts
+}
+
+func TestBuild_OnErrorRecord(t *testing.T) {
+	t.Parallel()
+
+	inDir, opts := vanishingInput(t)
+	opts.OnError = auditpack.ErrorsRecord
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	if got := manifestPaths(t, outDir); len(got) != 2 || got[0] != "a.txt" || got[1] != "z.txt" {
+		t.Fatalf("unexpected files: %v", got)
+	}
+	if len(m.Errors) != 1 || m.Errors[0] != (manifest.ErrorEntry{Path: "gone.txt", Class: auditpack.ErrClassNotFound}) {
+		t.Fatalf("unexpected errors: %+v", m.Errors)
+	}
+	if m.Summary.ErrorCount != 1 {
+		t.Fatalf("unexpected error_count: %d", m.Summary.ErrorCount)
+	}
+	meta := readRunMeta(t, outDir)
+	if !meta.Incomplete || meta.OnError != "record" {
+		t.Fatalf("run_meta.json should mark the pack incomplete: %+v", meta)
+	}
+
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("verify pack: %v", err)
+	}
+	// Whatever is at an unreadable path later is neither missing nor extra.
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("verify input (file absent): %v", err)
+	}
+	mustWrite(t, filepath.Join(inDir, "gone.txt"), []byte("back again\n"))
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("verify input (file back): %v", err)
+	}
+}
+
+func TestBuild_OnErrorFailIsDefault(t *testing.T) {
+	t.Parallel()
+
+	inDir, opts := vanishingInput(t)
+	outDir := filepath.Join(t.TempDir(), "out")
+	if err := auditpack.Build(inDir, outDir, opts); err == nil {
+		t.Fatalf("expected build to fail on an unreadable file")
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Fatalf("failed build should not create outDir: %v", err)
+	}
+
+	if _, err := auditpack.ParseErrorPolicy("ignore"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+func TestBuild_JobsDoNotChangeOutput(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	for i := 0; i < 40; i++ {
+		p := filepath.Join(inDir, fmt.Sprintf("d%d", i%4), fmt.Sprintf("f%02d.txt", i))
+		mustWrite(t, p, []byte(strings.Repeat(fmt.Sprintf("line %d\n", i), i+1)))
+	}
+
+	var want []byte
+	for _, jobs := range []int{1, 2, 7, 0} {
+		outDir := t.TempDir()
+		opts := auditpack.DefaultOptions()
+		opts.InputLabel = "test/input"
+		opts.Jobs = jobs
+
+		if err := auditpack.Build(inDir, outDir, opts); err != nil {
+			t.Fatalf("build jobs=%d: %v", jobs, err)
+		}
+		got := mustRead(t, filepath.Join(outDir, "manifest.json"))
+		if want == nil {
+			want = got
+		} else if string(got) != string(want) {
+			t.Fatalf("manifest.json differs for jobs=%d", jobs)
+		}
+
+		if err := auditpack.VerifyInputWith(inDir, outDir, auditpack.VerifyOptions{Strict: true, Jobs: jobs}); err != nil {
+			t.Fatalf("verify input jobs=%d: %v", jobs, err)
+		}
+	}
+}
+
+func TestVerifyInput_ParallelReportsFirstMismatch(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		mustWrite(t, filepath.Join(inDir, fmt.Sprintf("f%02d.txt", i)), []byte(fmt.Sprintf("%d\n", i)))
+	}
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	// Tamper with several files; the reported one must be the first in path order.
+	for _, n := range []string{"f15.txt", "f03.txt", "f11.txt"} {
+		mustWrite(t, filepath.Join(inDir, n), []byte("tampered\n"))
+	}
+
+	for _, jobs := range []int{1, 4, 16} {
+		err := auditpack.VerifyInputWith(inDir, outDir, auditpack.VerifyOptions{Jobs: jobs})
+		if err == nil {
+			t.Fatalf("jobs=%d: expected verify failure, got nil", jobs)
+		}
+		if !strings.Contains(err.Error(), `"f03.txt"`) {
+			t.Fatalf("jobs=%d: expected failure for f03.txt, got %v", jobs, err)
+		}
+	}
+}
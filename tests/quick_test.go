@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+func TestVerifyInputQuick_RehashesOnlySuspiciousFiles(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		mustWrite(t, filepath.Join(inDir, name), []byte("content "+name+"\n"))
+	}
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Capture = []string{auditpack.AttrMTime}
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	// a.txt: same size, mtime restored. A quick check cannot see this.
+	a := filepath.Join(inDir, "a.txt")
+	info, err := os.Stat(a)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	mustWrite(t, a, []byte("CONTENT a.txt\n"))
+	if err := os.Chtimes(a, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	// b.txt: same size, new mtime. Re-hashed and reported as modified.
+	b := filepath.Join(inDir, "b.txt")
+	mustWrite(t, b, []byte("CONTENT b.txt\n"))
+	later := info.ModTime().Add(time.Hour)
+	if err := os.Chtimes(b, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	// c.txt: touched only. Re-hashed; contents match, mtime does not.
+	c := filepath.Join(inDir, "c.txt")
+	if err := os.Chtimes(c, later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	rep, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, auditpack.VerifyOptions{Quick: true})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !rep.Quick || rep.Rehashed != 2 {
+		t.Fatalf("expected a quick report with 2 files re-hashed, got %+v", rep)
+	}
+	if len(rep.Problems) != 2 ||
+		rep.Problems[0].Path != "b.txt" || rep.Problems[0].Kind != auditpack.ProblemModified ||
+		rep.Problems[1].Path != "c.txt" || rep.Problems[1].Kind != auditpack.ProblemAttrChanged {
+		t.Fatalf("unexpected problems: %+v", rep.Problems)
+	}
+
+	// With mtime ignored, the touched file passes once its contents re-hash clean.
+	rep, err = auditpack.VerifyInputReport(context.Background(), inDir, outDir,
+		auditpack.VerifyOptions{Quick: true, IgnoreAttrs: []string{auditpack.AttrMTime}})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if rep.Rehashed != 2 || len(rep.Problems) != 1 || rep.Problems[0].Path != "b.txt" {
+		t.Fatalf("unexpected report with mtime ignored: %+v", rep)
+	}
+
+	// The full check still catches a.txt.
+	if err := auditpack.VerifyInputWith(inDir, outDir, auditpack.VerifyOptions{IgnoreAttrs: []string{auditpack.AttrMTime}}); err == nil ||
+		!strings.Contains(err.Error(), "a.txt") {
+		t.Fatalf("expected full verify to catch a.txt, got %v", err)
+	}
+}
+
+func TestVerifyInputQuick_SizeOnlyWithoutCapturedMTime(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	mustWrite(t, filepath.Join(inDir, "b.txt"), []byte("beta\n"))
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("ALPHA\n"))
+	rep, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, auditpack.VerifyOptions{Quick: true})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !rep.OK || rep.Rehashed != 0 {
+		t.Fatalf("expected a same-size rewrite to pass a size-only quick check, got %+v", rep)
+	}
+
+	mustWrite(t, filepath.Join(inDir, "b.txt"), []byte("beta, longer\n"))
+	rep, err = auditpack.VerifyInputReport(context.Background(), inDir, outDir, auditpack.VerifyOptions{Quick: true})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if rep.Rehashed != 1 || len(rep.Problems) != 1 || rep.Problems[0].Kind != auditpack.ProblemSizeChanged {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+}
+
+func TestCLI_VerifyQuickSaysItIsNotCryptographic(t *testing.T) {
+	_, bin := buildAuditpackBinary(t)
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	runCmdOK(t, bin, "run", "--in", inDir, "--out", outDir, "--capture", "mtime")
+
+	out, err := exec.Command(bin, "verify", "--pack", outDir, "--in", inDir, "--quick").Output()
+	if err != nil {
+		t.Fatalf("verify --quick: %v\n%s", err, out)
+	}
+	s := string(out)
+	if !strings.Contains(s, "QUICK CHECK") || !strings.Contains(s, "NOT cryptographic verification") ||
+		strings.Contains(s, "OK: input tree matches manifest.json") {
+		t.Fatalf("quick verify output does not say it is a quick check:\n%s", s)
+	}
+
+	if err := exec.Command(bin, "verify", "--pack", outDir, "--quick").Run(); err == nil {
+		t.Fatalf("expected --quick without --in to fail")
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+func TestVerifyInputReport_CollectsEveryProblem(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		mustWrite(t, filepath.Join(inDir, fmt.Sprintf("f%02d.txt", i)), []byte(fmt.Sprintf("file %d\n", i)))
+	}
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	mustWrite(t, filepath.Join(inDir, "f02.txt"), []byte("FILE 2\n"))      // same size
+	mustWrite(t, filepath.Join(inDir, "f05.txt"), []byte("much longer\n")) // new size
+	if err := os.Remove(filepath.Join(inDir, "f07.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	mustWrite(t, filepath.Join(inDir, "new.txt"), []byte("extra\n"))
+
+	want := []auditpack.Problem{
+		{Path: "f02.txt", Kind: auditpack.ProblemModified, Field: "sha256"},
+		{Path: "f05.txt", Kind: auditpack.ProblemSizeChanged, Field: "size_bytes", Expected: "7", Actual: "12"},
+		{Path: "f07.txt", Kind: auditpack.ProblemMissing, Expected: "file"},
+		{Path: "new.txt", Kind: auditpack.ProblemExtra, Actual: "file"},
+	}
+
+	var first []byte
+	for _, jobs := range []int{1, 8} {
+		vopts := auditpack.VerifyOptions{Strict: true, Jobs: jobs}
+		rep, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, vopts)
+		if err != nil {
+			t.Fatalf("jobs=%d: verify: %v", jobs, err)
+		}
+		if rep.OK || len(rep.Problems) != len(want) {
+			t.Fatalf("jobs=%d: unexpected report: %+v", jobs, rep)
+		}
+		for i, w := range want {
+			got := rep.Problems[i]
+			if got.Path != w.Path || got.Kind != w.Kind || got.Field != w.Field {
+				t.Fatalf("jobs=%d: problem %d: got %+v want %+v", jobs, i, got, w)
+			}
+			if (w.Expected != "" && got.Expected != w.Expected) || (w.Actual != "" && got.Actual != w.Actual) {
+				t.Fatalf("jobs=%d: problem %d values: got %+v want %+v", jobs, i, got, w)
+			}
+		}
+		if rep.Problems[0].Expected == "" || rep.Problems[0].Actual == "" {
+			t.Fatalf("modified problem should carry both digests: %+v", rep.Problems[0])
+		}
+
+		// The JSON report is byte-identical for every Jobs value.
+		path := filepath.Join(t.TempDir(), "report.json")
+		if err := rep.WriteJSON(path); err != nil {
+			t.Fatalf("write report: %v", err)
+		}
+		b := mustRead(t, path)
+		if first == nil {
+			first = b
+		} else if string(b) != string(first) {
+			t.Fatalf("report.json differs between jobs values:\n%s\n---\n%s", first, b)
+		}
+	}
+
+	// The error-returning API and FailFast report the first problem only.
+	err := auditpack.VerifyInput(inDir, outDir, true)
+	if err == nil || !strings.Contains(err.Error(), `sha256 mismatch for "f02.txt"`) {
+		t.Fatalf("unexpected VerifyInput error: %v", err)
+	}
+	rep, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, auditpack.VerifyOptions{Strict: true, FailFast: true})
+	if err != nil {
+		t.Fatalf("fail-fast verify: %v", err)
+	}
+	if len(rep.Problems) != 1 || rep.Problems[0].Path != "f02.txt" {
+		t.Fatalf("fail-fast should report only the first problem: %+v", rep.Problems)
+	}
+}
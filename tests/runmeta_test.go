@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+)
+
+// resealPack rewrites manifest.sha256 after a test edits the pack documents,
+// so only the semantic checks in VerifyPack can catch the edit.
+func resealPack(t *testing.T, outDir string) {
+	t.Helper()
+	var lines []string
+	for _, name := range []string{"manifest.json", "run_meta.json"} {
+		d, _, err := hashing.HashFile(filepath.Join(outDir, name), []string{hashing.SHA256})
+		if err != nil {
+			t.Fatalf("hash %s: %v", name, err)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s", d[hashing.SHA256], name))
+	}
+	mustWrite(t, filepath.Join(outDir, "manifest.sha256"), []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+func TestVerifyPack_RunMetaMustAgreeWithManifest(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		file      string
+		old, new  string
+		wantError string
+	}{
+		{"input", "run_meta.json", `"input": "fixtures/input/case01"`, `"input": "elsewhere"`, `run_meta.json input "elsewhere" does not match`},
+		{"version", "run_meta.json", `"version": "dev"`, `"version": "v9"`, `run_meta.json version "v9" does not match`},
+		{"file_count", "run_meta.json", `"file_count": 2`, `"file_count": 3`, "run_meta.json summary.file_count 3 does not match"},
+		{"unknown manifest field", "manifest.json", `"version": "dev",`, `"version": "dev", "signed_by": "me",`, `unknown field "signed_by"`},
+		{"unknown run_meta field", "run_meta.json", `"tool": "proof-first-auditpack",`, `"tool": "proof-first-auditpack", "host": "x",`, `unknown field "host"`},
+		{"trailing data", "run_meta.json", "  }\n}\n", "  }\n}\n{}\n", "unexpected data after top-level value"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			outDir := t.TempDir()
+			for _, name := range []string{"manifest.json", "run_meta.json", "manifest.sha256"} {
+				mustWrite(t, filepath.Join(outDir, name), mustRead(t, filepath.Join("..", "fixtures", "expected", "case01", name)))
+			}
+			if err := auditpack.VerifyPack(outDir); err != nil {
+				t.Fatalf("golden pack should verify: %v", err)
+			}
+
+			p := filepath.Join(outDir, c.file)
+			orig := string(mustRead(t, p))
+			if !strings.Contains(orig, c.old) {
+				t.Fatalf("%s does not contain %q", c.file, c.old)
+			}
+			if err := os.WriteFile(p, []byte(strings.Replace(orig, c.old, c.new, 1)), 0o644); err != nil {
+				t.Fatalf("edit: %v", err)
+			}
+			resealPack(t, outDir)
+
+			err := auditpack.VerifyPack(outDir)
+			if err == nil || !strings.Contains(err.Error(), c.wantError) {
+				t.Fatalf("expected %q, got %v", c.wantError, err)
+			}
+		})
+	}
+}
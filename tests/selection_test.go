@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+)
+
+func selectionInput(t *testing.T) (inDir, outDir string) {
+	t.Helper()
+	inDir = filepath.Join(t.TempDir(), "in")
+	outDir = t.TempDir()
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-08", "a.pdf"), []byte("august a\n"))
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-09", "b.pdf"), []byte("september b\n"))
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-09", "c.csv"), []byte("sep,c\n"))
+	mustWrite(t, filepath.Join(inDir, "notes.txt"), []byte("notes\n"))
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return inDir, outDir
+}
+
+func TestVerifyInputPaths_ChecksOnlySelectedEntries(t *testing.T) {
+	t.Parallel()
+	inDir, outDir := selectionInput(t)
+
+	// Outside the selection: deleted, modified and extra files are not reported.
+	if err := os.RemoveAll(filepath.Join(inDir, "invoices", "2026-08")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	mustWrite(t, filepath.Join(inDir, "notes.txt"), []byte("NOTES\n"))
+	mustWrite(t, filepath.Join(inDir, "stray.txt"), []byte("stray\n"))
+
+	vopts := auditpack.VerifyOptions{Strict: true, Paths: []string{"invoices/2026-09/**"}}
+	rep, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, vopts)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !rep.OK || rep.Entries != 4 || rep.Selected != 2 || rep.SelectedBytes != 18 || rep.TotalBytes != 33 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+
+	// Inside the selection, problems (including strict extras) are reported.
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-09", "b.pdf"), []byte("SEPTEMBER B\n"))
+	mustWrite(t, filepath.Join(inDir, "invoices", "2026-09", "d.pdf"), []byte("new\n"))
+	rep, err = auditpack.VerifyInputReport(context.Background(), inDir, outDir, vopts)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(rep.Problems) != 2 ||
+		rep.Problems[0].Path != "invoices/2026-09/b.pdf" || rep.Problems[0].Kind != auditpack.ProblemModified ||
+		rep.Problems[1].Path != "invoices/2026-09/d.pdf" || rep.Problems[1].Kind != auditpack.ProblemExtra {
+		t.Fatalf("unexpected problems: %+v", rep.Problems)
+	}
+
+	// Unanchored patterns match at any depth, as with --include.
+	rep, err = auditpack.VerifyInputReport(context.Background(), inDir, outDir, auditpack.VerifyOptions{Paths: []string{"*.csv"}})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !rep.OK || rep.Selected != 1 {
+		t.Fatalf("unexpected report for *.csv: %+v", rep)
+	}
+}
+
+func TestVerifyInputPaths_RejectsPatternMatchingNothing(t *testing.T) {
+	t.Parallel()
+	inDir, outDir := selectionInput(t)
+
+	vopts := auditpack.VerifyOptions{Paths: []string{"invoices/2026-09/**", "invoices/2026-10/**"}}
+	_, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, vopts)
+	if !errors.Is(err, auditpack.ErrUsage) || !strings.Contains(err.Error(), "2026-10") {
+		t.Fatalf("expected a usage error naming the unmatched pattern, got %v", err)
+	}
+}
+
+func TestCLI_VerifyPathsFromReportsCoverage(t *testing.T) {
+	_, bin := buildAuditpackBinary(t)
+	inDir, outDir := selectionInput(t)
+	if err := os.Remove(filepath.Join(inDir, "notes.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	list := filepath.Join(t.TempDir(), "paths.txt")
+	mustWrite(t, list, []byte("# September only\ninvoices/2026-09/b.pdf\r\n\ninvoices/2026-09/c.csv\n"))
+	out, err := exec.Command(bin, "verify", "--pack", outDir, "--in", inDir, "--paths-from", list).Output()
+	if err != nil {
+		t.Fatalf("verify --paths-from: %v\n%s", err, out)
+	}
+	s := string(out)
+	if !strings.Contains(s, "checked 2 of 4 manifest entries (18 of 33 bytes)") ||
+		!strings.Contains(s, "OK: selected input paths match manifest.json") {
+		t.Fatalf("unexpected output:\n%s", s)
+	}
+
+	cmd := exec.Command(bin, "verify", "--pack", outDir, "--path", "invoices/**")
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("expected --path without --in to fail")
+	}
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+func signedTestPack(t *testing.T) string {
+	t.Helper()
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "ledger.csv"), []byte("id,amount\n1,100\n"))
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return outDir
+}
+
+func TestSignPack_RoundTripAndTampering(t *testing.T) {
+	t.Parallel()
+	outDir := signedTestPack(t)
+	pub, priv, err := signing.GenerateEd25519()
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+
+	err = auditpack.VerifyPackSignature(context.Background(), outDir, pub)
+	var ie *auditpack.IntegrityError
+	if !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureMissing {
+		t.Fatalf("expected signature_missing before signing, got %v", err)
+	}
+
+	if err := auditpack.SignPack(context.Background(), outDir, priv); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := auditpack.VerifyPackSignature(context.Background(), outDir, pub); err != nil {
+		t.Fatalf("verify signature: %v", err)
+	}
+	// A second signer does not silently replace the first signature.
+	_, otherPriv, _ := signing.GenerateEd25519()
+	if err := auditpack.SignPack(context.Background(), outDir, otherPriv); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist when signing a signed pack, got %v", err)
+	}
+	if err := auditpack.VerifyPackSignature(context.Background(), outDir, pub); err != nil {
+		t.Fatalf("first signature was replaced: %v", err)
+	}
+	if err := auditpack.VerifyPackStrict(context.Background(), outDir); err != nil {
+		t.Fatalf("strict-pack with a signature: %v", err)
+	}
+
+	otherPub, _, _ := signing.GenerateEd25519()
+	if err := auditpack.VerifyPackSignature(context.Background(), outDir, otherPub); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureInvalid {
+		t.Fatalf("expected signature_invalid for another key, got %v", err)
+	}
+
+	// Editing manifest.json leaves manifest.sha256 and its signature intact,
+	// but the pack itself no longer verifies.
+	manPath := filepath.Join(outDir, "manifest.json")
+	orig := mustRead(t, manPath)
+	mustWrite(t, manPath, append(orig, ' '))
+	if err := auditpack.VerifyPackSignature(context.Background(), outDir, pub); !errors.As(err, &ie) || ie.Kind != auditpack.KindChecksumMismatch {
+		t.Fatalf("expected checksum_mismatch for an edited pack, got %v", err)
+	}
+	mustWrite(t, manPath, orig)
+
+	// Editing the pack and regenerating manifest.sha256 keeps the pack
+	// self-consistent, but the signature no longer matches.
+	mustWrite(t, manPath, bytes.Replace(mustRead(t, manPath), []byte(`"test/input"`), []byte(`"forged/input"`), 1))
+	metaPath := filepath.Join(outDir, "run_meta.json")
+	mustWrite(t, metaPath, bytes.Replace(mustRead(t, metaPath), []byte(`"test/input"`), []byte(`"forged/input"`), 1))
+	resealPack(t, outDir)
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("resealed pack should be self-consistent: %v", err)
+	}
+	err = auditpack.VerifyPackSignature(context.Background(), outDir, pub)
+	if !errors.Is(err, auditpack.ErrIntegrity) || !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureInvalid {
+		t.Fatalf("expected signature_invalid after tampering, got %v", err)
+	}
+}
+
+func TestCLI_KeygenSignVerify(t *testing.T) {
+	_, bin := buildAuditpackBinary(t)
+	outDir := signedTestPack(t)
+	keys := filepath.Join(t.TempDir(), "alice")
+
+	runCmdOK(t, bin, "keygen", "--out", keys)
+	info, err := os.Stat(keys + ".key")
+	if err != nil {
+		t.Fatalf("stat key: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("private key mode = %v, want 0600", info.Mode().Perm())
+	}
+	if err := exec.Command(bin, "keygen", "--out", keys).Run(); err == nil {
+		t.Fatalf("expected keygen to refuse to overwrite existing keys")
+	}
+
+	runCmdOK(t, bin, "sign", "--pack", outDir, "--key", keys+".key")
+	out, err := exec.Command(bin, "verify", "--pack", outDir, "--pubkey", keys+".pub").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "manifest.sha256.sig is a valid signature by key") {
+		t.Fatalf("verify --pubkey: %v\n%s", err, out)
+	}
+
+	// A different key is an integrity failure (exit 1).
+	other := filepath.Join(t.TempDir(), "mallory")
+	runCmdOK(t, bin, "keygen", "--out", other)
+	cmd := exec.Command(bin, "verify", "--pack", outDir, "--pubkey", other+".pub")
+	var ee *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 1 {
+		t.Fatalf("expected exit 1 for the wrong key, got %v", err)
+	}
+}
+
+func TestSignPack_OpenSSLInterop(t *testing.T) {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not installed")
+	}
+	t.Parallel()
+	outDir := signedTestPack(t)
+	dir := t.TempDir()
+
+	// A key generated by OpenSSL signs; OpenSSL verifies our signature.
+	keyPath := filepath.Join(dir, "k.key")
+	if out, err := exec.Command(openssl, "genpkey", "-algorithm", "ed25519", "-out", keyPath).CombinedOutput(); err != nil {
+		t.Skipf("openssl cannot generate ed25519 keys: %v\n%s", err, out)
+	}
+	pubPath := filepath.Join(dir, "k.pub")
+	if out, err := exec.Command(openssl, "pkey", "-in", keyPath, "-pubout", "-out", pubPath).CombinedOutput(); err != nil {
+		t.Fatalf("openssl pkey: %v\n%s", err, out)
+	}
+	priv, err := signing.ParseEd25519PrivateKey(mustRead(t, keyPath))
+	if err != nil {
+		t.Fatalf("parse openssl key: %v", err)
+	}
+	if err := auditpack.SignPack(context.Background(), outDir, priv); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	sig, err := signing.DecodeSignature(mustRead(t, filepath.Join(outDir, auditpack.SignatureFile)))
+	if err != nil {
+		t.Fatalf("decode signature: %v", err)
+	}
+	rawSig := filepath.Join(dir, "sig.bin")
+	mustWrite(t, rawSig, sig)
+	cmd := exec.Command(openssl, "pkeyutl", "-verify", "-pubin", "-inkey", pubPath, "-rawin",
+		"-in", filepath.Join(outDir, "manifest.sha256"), "-sigfile", rawSig)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("openssl pkeyutl -verify: %v\n%s", err, out)
+	}
+}
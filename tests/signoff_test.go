@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+// trustedKeysJSON renders a trusted keys file for the named public keys.
+func trustedKeysJSON(t *testing.T, keys map[string]ed25519.PublicKey) []byte {
+	t.Helper()
+	type entry struct {
+		Name      string `json:"name"`
+		PublicKey string `json:"public_key"`
+	}
+	var f struct {
+		Keys []entry `json:"keys"`
+	}
+	for name, pub := range keys {
+		pemBytes, err := signing.MarshalPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Keys = append(f.Keys, entry{Name: name, PublicKey: string(pemBytes)})
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSignOff_Threshold(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	outDir := signedTestPack(t)
+	prepPub, prep, _ := signing.GenerateEd25519()
+	revPub, rev, _ := signing.GenerateEd25519()
+	_, stranger, _ := signing.GenerateEd25519()
+	trusted, err := auditpack.ParseTrustedKeys(trustedKeysJSON(t, map[string]ed25519.PublicKey{"preparer": prepPub, "reviewer": revPub}))
+	if err != nil {
+		t.Fatalf("parse trusted keys: %v", err)
+	}
+
+	var ie *auditpack.IntegrityError
+	if _, err := auditpack.VerifySignOffs(context.Background(), outDir, trusted, 1); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureThreshold {
+		t.Fatalf("expected signature_threshold for an unsigned pack, got %v", err)
+	}
+
+	first, err := auditpack.AddSignOff(ctx, outDir, prep)
+	if err != nil {
+		t.Fatalf("preparer sign-off: %v", err)
+	}
+	before := mustRead(t, filepath.Join(outDir, first))
+	if _, err := auditpack.AddSignOff(ctx, outDir, prep); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected a second sign-off by the same key to fail with ErrExist, got %v", err)
+	}
+	if _, err := auditpack.AddSignOff(ctx, outDir, stranger); err != nil {
+		t.Fatalf("stranger sign-off: %v", err)
+	}
+
+	// One trusted signer plus an untrusted one does not meet a threshold of 2.
+	rep, err := auditpack.VerifySignOffs(context.Background(), outDir, trusted, 2)
+	if !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureThreshold || rep == nil || rep.Satisfied != 1 {
+		t.Fatalf("expected 1 of 2 signatures, got %+v, %v", rep, err)
+	}
+	if len(rep.Signers) != 2 {
+		t.Fatalf("expected both signers listed, got %+v", rep.Signers)
+	}
+
+	if _, err := auditpack.AddSignOff(ctx, outDir, rev); err != nil {
+		t.Fatalf("reviewer sign-off: %v", err)
+	}
+	if !bytes.Equal(before, mustRead(t, filepath.Join(outDir, first))) {
+		t.Fatalf("adding a sign-off changed an existing one")
+	}
+	rep, err = auditpack.VerifySignOffs(context.Background(), outDir, trusted, 2)
+	if err != nil || rep.Satisfied != 2 || len(rep.Signers) != 3 {
+		t.Fatalf("expected 2 of 2 with 3 signers listed, got %+v, %v", rep, err)
+	}
+	if err := auditpack.VerifyPackStrict(ctx, outDir); err != nil {
+		t.Fatalf("strict-pack with sign-offs: %v", err)
+	}
+
+	// Changing the pack after sign-off invalidates every signature.
+	manPath := filepath.Join(outDir, "manifest.json")
+	mustWrite(t, manPath, bytes.Replace(mustRead(t, manPath), []byte(`"test/input"`), []byte(`"forged/input"`), 1))
+	metaPath := filepath.Join(outDir, "run_meta.json")
+	mustWrite(t, metaPath, bytes.Replace(mustRead(t, metaPath), []byte(`"test/input"`), []byte(`"forged/input"`), 1))
+	resealPack(t, outDir)
+	rep, err = auditpack.VerifySignOffs(context.Background(), outDir, trusted, 1)
+	if !errors.Is(err, auditpack.ErrIntegrity) || rep.Satisfied != 0 {
+		t.Fatalf("expected no valid sign-offs after tampering, got %+v, %v", rep, err)
+	}
+	for _, s := range rep.Signers {
+		if s.Valid || !strings.Contains(s.Reason, "different manifest.sha256") {
+			t.Fatalf("expected a stale-signature reason, got %+v", s)
+		}
+	}
+
+	if _, err := auditpack.VerifySignOffs(context.Background(), outDir, trusted, 3); !errors.Is(err, auditpack.ErrUsage) {
+		t.Fatalf("expected a usage error for a threshold above the trusted key count, got %v", err)
+	}
+}
+
+func TestCLI_SignOff(t *testing.T) {
+	_, bin := buildAuditpackBinary(t)
+	outDir := signedTestPack(t)
+	keys := t.TempDir()
+	for _, who := range []string{"preparer", "reviewer"} {
+		prefix := filepath.Join(keys, who)
+		runCmdOK(t, bin, "keygen", "--out", prefix)
+		runCmdOK(t, bin, "sign", "--pack", outDir, "--key", prefix+".key", "--add")
+	}
+	// A single-line base64 body is accepted as well as PEM.
+	reviewerPub := strings.Split(strings.TrimSpace(string(mustRead(t, filepath.Join(keys, "reviewer.pub")))), "\n")[1]
+	trusted := filepath.Join(keys, "keys.json")
+	mustWrite(t, trusted, []byte(`{"keys": [
+  {"name": "preparer", "public_key": `+jsonString(t, string(mustRead(t, filepath.Join(keys, "preparer.pub"))))+`},
+  {"name": "reviewer", "public_key": "`+reviewerPub+`"}
+]}`))
+
+	out, err := exec.Command(bin, "verify", "--pack", outDir, "--strict-pack", "--trusted-keys", trusted, "--require", "2").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "2 of 2 required") || !strings.Contains(string(out), "preparer") ||
+		!strings.Contains(string(out), "reviewer") || !strings.Contains(string(out), "OK: sign-off threshold met") {
+		t.Fatalf("verify --require 2: %v\n%s", err, out)
+	}
+
+	if err := os.Remove(filepath.Join(outDir, auditpack.SignaturesDir, signOffFileName(t, filepath.Join(keys, "reviewer.pub")))); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bin, "verify", "--pack", outDir, "--trusted-keys", trusted, "--require", "2")
+	var ee *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 1 {
+		t.Fatalf("expected exit 1 with one of two sign-offs, got %v", err)
+	}
+	cmd = exec.Command(bin, "verify", "--pack", outDir, "--require", "2")
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 2 {
+		t.Fatalf("expected exit 2 for --require without --trusted-keys, got %v", err)
+	}
+}
+
+func jsonString(t *testing.T, s string) string {
+	t.Helper()
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// signOffFileName returns the signatures/ file name for the key at pubPath.
+func signOffFileName(t *testing.T, pubPath string) string {
+	t.Helper()
+	pub, err := signing.ParseEd25519PublicKey(mustRead(t, pubPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := signing.KeyID(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id + ".json"
+}
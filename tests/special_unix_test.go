@@ -0,0 +1,112 @@
+//go:build unix
+
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+func mustMkfifo(t *testing.T, p string) {
+	t.Helper()
+	if err := syscall.Mkfifo(p, 0o644); err != nil {
+		t.Skipf("mkfifo not supported here: %v", err)
+	}
+}
+
+func TestBuild_RecordsSpecialFiles(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	outDir := t.TempDir()
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	mustMkfifo(t, filepath.Join(inDir, "pipe"))
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.OnSpecial = auditpack.SpecialRecord
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	if len(m.Skipped) != 1 || m.Skipped[0] != (manifest.SkippedEntry{Path: "pipe", Kind: "fifo"}) {
+		t.Fatalf("unexpected skipped section: %+v", m.Skipped)
+	}
+	var meta manifest.RunMeta
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "run_meta.json")), &meta); err != nil {
+		t.Fatalf("parse run_meta.json: %v", err)
+	}
+	if meta.Summary.SkippedCount != 1 || meta.OnSpecial != "record" {
+		t.Fatalf("unexpected run_meta: %+v", meta)
+	}
+
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("verify pack: %v", err)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("strict verify: %v", err)
+	}
+
+	// A new special file is now visible to --strict.
+	mustMkfifo(t, filepath.Join(inDir, "pipe2"))
+	err := auditpack.VerifyInput(inDir, outDir, true)
+	if err == nil || !strings.Contains(err.Error(), "extra special file") {
+		t.Fatalf("expected extra special file failure, got %v", err)
+	}
+
+	// So is a recorded one disappearing.
+	if err := os.Remove(filepath.Join(inDir, "pipe2")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.Remove(filepath.Join(inDir, "pipe")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	err = auditpack.VerifyInput(inDir, outDir, true)
+	if err == nil || !strings.Contains(err.Error(), "recorded special file missing") {
+		t.Fatalf("expected missing special file failure, got %v", err)
+	}
+}
+
+func TestBuild_SpecialFilePolicies(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join(t.TempDir(), "in")
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	mustMkfifo(t, filepath.Join(inDir, "pipe"))
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+
+	// Default: not listed, but still counted.
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	if len(m.Skipped) != 0 || m.Summary.SkippedCount != 1 {
+		t.Fatalf("default policy should count but not list special files: %+v, %+v", m.Skipped, m.Summary)
+	}
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("verify pack: %v", err)
+	}
+
+	opts.OnSpecial = auditpack.SpecialError
+	err := auditpack.Build(inDir, t.TempDir(), opts)
+	if err == nil || !strings.Contains(err.Error(), `"pipe" (fifo)`) {
+		t.Fatalf("expected special file error, got %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/signing"
+)
+
+// sshKeygen returns the ssh-keygen path, skipping the test if it is missing.
+func sshKeygen(t *testing.T) string {
+	t.Helper()
+	p, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	return p
+}
+
+// newSSHKey generates an Ed25519 key with ssh-keygen and returns its path and
+// an allowed_signers line for identity.
+func newSSHKey(t *testing.T, keygen, identity, passphrase string) (keyPath, allowedLine string) {
+	t.Helper()
+	keyPath = filepath.Join(t.TempDir(), "id_ed25519")
+	out, err := exec.Command(keygen, "-q", "-t", "ed25519", "-N", passphrase, "-C", identity, "-f", keyPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ssh-keygen: %v\n%s", err, out)
+	}
+	return keyPath, identity + " " + strings.TrimSpace(string(mustRead(t, keyPath+".pub"))) + "\n"
+}
+
+func TestSignPackSSH_SSHKeygenVerifies(t *testing.T) {
+	keygen := sshKeygen(t)
+	t.Parallel()
+	outDir := signedTestPack(t)
+	keyPath, line := newSSHKey(t, keygen, "alice@corp", "")
+	allowed := filepath.Join(t.TempDir(), "allowed_signers")
+	mustWrite(t, allowed, []byte(line))
+
+	signer, err := signing.LoadSSHSigner(keyPath)
+	if err != nil {
+		t.Fatalf("load ssh key: %v", err)
+	}
+	if err := auditpack.SignPackSSH(context.Background(), outDir, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := auditpack.VerifyPackStrict(context.Background(), outDir); err != nil {
+		t.Fatalf("strict-pack with an SSH signature: %v", err)
+	}
+	// Signing again fails and leaves the first signature untouched.
+	sigPath := filepath.Join(outDir, auditpack.SSHSignatureFile)
+	first := mustRead(t, sigPath)
+	if err := auditpack.SignPackSSH(context.Background(), outDir, signer); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist when SSH-signing a signed pack, got %v", err)
+	}
+	if !bytes.Equal(mustRead(t, sigPath), first) {
+		t.Fatalf("second SignPackSSH changed %s", auditpack.SSHSignatureFile)
+	}
+
+	cmd := exec.Command(keygen, "-Y", "verify", "-f", allowed, "-I", "alice@corp", "-n", auditpack.SSHNamespace,
+		"-s", sigPath)
+	cmd.Stdin = strings.NewReader(string(mustRead(t, filepath.Join(outDir, "manifest.sha256"))))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y verify: %v\n%s", err, out)
+	}
+}
+
+func TestVerifyPackSSH_AcceptsSSHKeygenSignature(t *testing.T) {
+	keygen := sshKeygen(t)
+	t.Parallel()
+	outDir := signedTestPack(t)
+	keyPath, line := newSSHKey(t, keygen, "alice@corp", "")
+
+	cmd := exec.Command(keygen, "-Y", "sign", "-f", keyPath, "-n", auditpack.SSHNamespace, filepath.Join(outDir, "manifest.sha256"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y sign: %v\n%s", err, out)
+	}
+	// ssh-keygen writes <file>.sig; the pack keeps it as manifest.sha256.sshsig.
+	if err := os.Rename(filepath.Join(outDir, "manifest.sha256.sig"), filepath.Join(outDir, auditpack.SSHSignatureFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	signers, err := signing.ParseAllowedSigners([]byte("# team keys\n" + line))
+	if err != nil {
+		t.Fatalf("parse allowed signers: %v", err)
+	}
+	if _, err := auditpack.VerifyPackSSH(context.Background(), outDir, signers, "alice@corp"); err != nil {
+		t.Fatalf("verify ssh-keygen signature: %v", err)
+	}
+
+	var ie *auditpack.IntegrityError
+	if _, err := auditpack.VerifyPackSSH(context.Background(), outDir, signers, "bob@corp"); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureInvalid {
+		t.Fatalf("expected signature_invalid for another identity, got %v", err)
+	}
+	restricted, err := signing.ParseAllowedSigners([]byte(strings.Replace(line, " ", ` namespaces="git" `, 1)))
+	if err != nil {
+		t.Fatalf("parse allowed signers: %v", err)
+	}
+	if _, err := auditpack.VerifyPackSSH(context.Background(), outDir, restricted, "alice@corp"); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureInvalid {
+		t.Fatalf("expected signature_invalid outside the allowed namespaces, got %v", err)
+	}
+
+	// A signature in another namespace must not verify as a pack signature.
+	cmd = exec.Command(keygen, "-Y", "sign", "-f", keyPath, "-n", "file", filepath.Join(outDir, "manifest.sha256"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -Y sign: %v\n%s", err, out)
+	}
+	if err := os.Rename(filepath.Join(outDir, "manifest.sha256.sig"), filepath.Join(outDir, auditpack.SSHSignatureFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auditpack.VerifyPackSSH(context.Background(), outDir, signers, "alice@corp"); !errors.As(err, &ie) || ie.Kind != auditpack.KindSignatureInvalid {
+		t.Fatalf("expected signature_invalid for the file namespace, got %v", err)
+	}
+}
+
+func TestAllowedSigners_Options(t *testing.T) {
+	t.Parallel()
+	pub, _, _ := signing.GenerateEd25519()
+	blob := append([]byte{0, 0, 0, 11}, "ssh-ed25519"...)
+	blob = append(append(blob, 0, 0, 0, 32), pub...)
+	key := base64.StdEncoding.EncodeToString(blob)
+	cases := []struct {
+		line    string
+		wantErr bool
+	}{
+		{`*@corp,!mallory@corp ssh-ed25519 ` + key, false},
+		{`"alice@corp" namespaces="auditpack,git",valid-after="20240101Z" ssh-ed25519 ` + key + ` alice`, false},
+		{`alice@corp frobnicate ssh-ed25519 ` + key, true},
+		{`alice@corp valid-before="2024" ssh-ed25519 ` + key, true},
+		{`alice@corp ssh-rsa ` + key, true},
+	}
+	for _, tc := range cases {
+		_, err := signing.ParseAllowedSigners([]byte(tc.line))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseAllowedSigners(%q): err = %v, wantErr %v", tc.line, err, tc.wantErr)
+		}
+	}
+
+	signers, _ := signing.ParseAllowedSigners([]byte(cases[0].line))
+	now := time.Now()
+	if err := signing.Authorize(signers, "alice@corp", "auditpack", blob, now); err != nil {
+		t.Errorf("alice@corp should match *@corp: %v", err)
+	}
+	if err := signing.Authorize(signers, "mallory@corp", "auditpack", blob, now); err == nil {
+		t.Errorf("mallory@corp should be excluded by !mallory@corp")
+	}
+	signers, _ = signing.ParseAllowedSigners([]byte(`alice@corp valid-before="20200101Z" ssh-ed25519 ` + key))
+	if err := signing.Authorize(signers, "alice@corp", "auditpack", blob, now); err == nil {
+		t.Errorf("an expired allowed_signers line should not authorize")
+	}
+	// An expired entry above a valid one for the same key does not reject it,
+	// as with ssh-keygen -Y verify.
+	rotated := `alice@corp valid-before="20200101Z" ssh-ed25519 ` + key + "\n" +
+		`alice@corp valid-after="20200101Z" ssh-ed25519 ` + key + "\n"
+	signers, _ = signing.ParseAllowedSigners([]byte(rotated))
+	if err := signing.Authorize(signers, "alice@corp", "auditpack", blob, now); err != nil {
+		t.Errorf("a valid line after an expired one should authorize: %v", err)
+	}
+	if err := signing.Authorize(signers[:1], "alice@corp", "auditpack", blob, now); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected the expiry as the reason, got %v", err)
+	}
+}
+
+func TestCLI_SignSSHWithAgent(t *testing.T) {
+	keygen := sshKeygen(t)
+	agent, err1 := exec.LookPath("ssh-agent")
+	add, err2 := exec.LookPath("ssh-add")
+	if err1 != nil || err2 != nil {
+		t.Skip("ssh-agent or ssh-add not installed")
+	}
+	_, bin := buildAuditpackBinary(t)
+	outDir := signedTestPack(t)
+	keyPath, line := newSSHKey(t, keygen, "alice@corp", "correct horse")
+	allowed := filepath.Join(t.TempDir(), "allowed_signers")
+	mustWrite(t, allowed, []byte(line))
+
+	// Without an agent, a passphrase-protected key is a usage error.
+	cmd := exec.Command(bin, "sign", "--pack", outDir, "--ssh-key", keyPath)
+	cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK=")
+	var ee *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 2 {
+		t.Fatalf("expected exit 2 for an encrypted key without an agent, got %v", err)
+	}
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	agentCmd := exec.Command(agent, "-D", "-a", sock)
+	if err := agentCmd.Start(); err != nil {
+		t.Skipf("start ssh-agent: %v", err)
+	}
+	t.Cleanup(func() { _ = agentCmd.Process.Kill(); _ = agentCmd.Wait() })
+	env := append(os.Environ(), "SSH_AUTH_SOCK="+sock)
+
+	// The agent needs the decrypted key; load it from an unencrypted copy.
+	plain := filepath.Join(t.TempDir(), "plain")
+	mustWrite(t, plain, mustRead(t, keyPath))
+	if err := os.Chmod(plain, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(keygen, "-p", "-q", "-P", "correct horse", "-N", "", "-f", plain).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen -p: %v\n%s", err, out)
+	}
+	for i := 0; ; i++ { // the agent may not be listening yet
+		addCmd := exec.Command(add, "-q", plain)
+		addCmd.Env = env
+		out, err := addCmd.CombinedOutput()
+		if err == nil {
+			break
+		}
+		if i == 50 {
+			t.Skipf("ssh-add: %v\n%s", err, out)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for _, key := range []string{keyPath, keyPath + ".pub"} {
+		_ = os.Remove(filepath.Join(outDir, auditpack.SSHSignatureFile))
+		cmd = exec.Command(bin, "sign", "--pack", outDir, "--ssh-key", key)
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("sign --ssh-key %s via agent: %v\n%s", filepath.Base(key), err, out)
+		}
+		out, err := exec.Command(bin, "verify", "--pack", outDir, "--allowed-signers", allowed, "--identity", "alice@corp").CombinedOutput()
+		if err != nil || !strings.Contains(string(out), "manifest.sha256.sshsig is a valid signature by \"alice@corp\"") {
+			t.Fatalf("verify --allowed-signers: %v\n%s", err, out)
+		}
+	}
+
+	cmd = exec.Command(bin, "verify", "--pack", outDir, "--allowed-signers", allowed, "--identity", "bob@corp")
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 1 {
+		t.Fatalf("expected exit 1 for an identity that did not sign, got %v", err)
+	}
+	cmd = exec.Command(bin, "verify", "--pack", outDir, "--allowed-signers", allowed)
+	if err := cmd.Run(); !errors.As(err, &ee) || ee.ExitCode() != 2 {
+		t.Fatalf("expected exit 2 for --allowed-signers without --identity, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/hashing"
+)
+
+func TestVerifyPackStrict(t *testing.T) {
+	t.Parallel()
+
+	inDir := filepath.Join("..", "fixtures", "input", "case01")
+	build := func(t *testing.T, statCache bool) string {
+		t.Helper()
+		outDir := t.TempDir()
+		opts := auditpack.DefaultOptions()
+		opts.InputLabel = "fixtures/input/case01"
+		opts.StatCache = statCache
+		if err := auditpack.Build(inDir, outDir, opts); err != nil {
+			t.Fatalf("build: %v", err)
+		}
+		return outDir
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		t.Parallel()
+		for _, statCache := range []bool{false, true} {
+			if err := auditpack.VerifyPackStrict(context.Background(), build(t, statCache)); err != nil {
+				t.Fatalf("stat-cache=%v: %v", statCache, err)
+			}
+		}
+	})
+
+	cases := []struct {
+		name      string
+		tamper    func(t *testing.T, outDir string)
+		wantError string
+	}{
+		{"extra file", func(t *testing.T, outDir string) {
+			mustWrite(t, filepath.Join(outDir, "notes.txt"), []byte("hi\n"))
+		}, "unexpected file in pack: notes.txt"},
+		{"temp file", func(t *testing.T, outDir string) {
+			mustWrite(t, filepath.Join(outDir, "manifest.json.tmp-42"), []byte("{"))
+		}, "stray temp file from an interrupted write: manifest.json.tmp-42"},
+		{"subdirectory", func(t *testing.T, outDir string) {
+			if err := os.Mkdir(filepath.Join(outDir, "old"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}, "unexpected directory in pack: old"},
+		{"stray checksum file", func(t *testing.T, outDir string) {
+			d, _, err := hashing.HashFile(filepath.Join(outDir, "manifest.json"), []string{hashing.SHA512})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustWrite(t, filepath.Join(outDir, "manifest.sha512"), []byte(fmt.Sprintf("%s  manifest.json\n", d[hashing.SHA512])))
+		}, "unexpected file in pack: manifest.sha512"},
+		{"run_meta.json not covered", func(t *testing.T, outDir string) {
+			p := filepath.Join(outDir, "manifest.sha256")
+			lines := strings.Split(strings.TrimSpace(string(mustRead(t, p))), "\n")
+			var kept []string
+			for _, ln := range lines {
+				if !strings.HasSuffix(ln, "run_meta.json") {
+					kept = append(kept, ln)
+				}
+			}
+			mustWrite(t, p, []byte(strings.Join(kept, "\n")+"\n"))
+		}, "manifest.sha256 does not cover run_meta.json"},
+		{"duplicate line", func(t *testing.T, outDir string) {
+			p := filepath.Join(outDir, "manifest.sha256")
+			b := mustRead(t, p)
+			mustWrite(t, p, append(b, b...))
+		}, "manifest.sha256 lists manifest.json more than once"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			outDir := build(t, false)
+			c.tamper(t, outDir)
+			// The lenient check still passes: only the strict one notices.
+			if err := auditpack.VerifyPack(outDir); err != nil {
+				t.Fatalf("VerifyPack: %v", err)
+			}
+			err := auditpack.VerifyPackStrict(context.Background(), outDir)
+			if err == nil || !strings.Contains(err.Error(), c.wantError) {
+				t.Fatalf("expected %q, got %v", c.wantError, err)
+			}
+		})
+	}
+}
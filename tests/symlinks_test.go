@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+func mustSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported here: %v", err)
+	}
+}
+
+func symlinkInput(t *testing.T) (root, inDir string) {
+	t.Helper()
+	root = t.TempDir()
+	inDir = filepath.Join(root, "in")
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	mustWrite(t, filepath.Join(root, "outside.txt"), []byte("outside\n"))
+	mustSymlink(t, "a.txt", filepath.Join(inDir, "link.txt"))
+	return root, inDir
+}
+
+func TestBuild_SymlinkPolicies(t *testing.T) {
+	t.Parallel()
+
+	_, inDir := symlinkInput(t)
+
+	build := func(policy auditpack.SymlinkPolicy) (string, error) {
+		outDir := t.TempDir()
+		opts := auditpack.DefaultOptions()
+		opts.InputLabel = "test/input"
+		opts.Symlinks = policy
+		return outDir, auditpack.Build(inDir, outDir, opts)
+	}
+
+	// skip: link silently left out (historical behavior).
+	outDir, err := build(auditpack.SymlinksSkip)
+	if err != nil {
+		t.Fatalf("build skip: %v", err)
+	}
+	if got := manifestPaths(t, outDir); len(got) != 1 || got[0] != "a.txt" {
+		t.Fatalf("skip: unexpected paths %v", got)
+	}
+
+	// record: link appears as a symlink entry with its target.
+	outDir, err = build(auditpack.SymlinksRecord)
+	if err != nil {
+		t.Fatalf("build record: %v", err)
+	}
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	if len(m.Files) != 2 || m.Files[1].Type != manifest.TypeSymlink || m.Files[1].Target != "a.txt" {
+		t.Fatalf("record: unexpected entries %+v", m.Files)
+	}
+	if m.Summary.FileCount != 1 || m.Summary.SymlinkCount != 1 {
+		t.Fatalf("record: file_count counts regular files only: %+v", m.Summary)
+	}
+	if err := auditpack.VerifyPack(outDir); err != nil {
+		t.Fatalf("verify pack: %v", err)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("verify input: %v", err)
+	}
+
+	// follow: link hashed as the file it points to.
+	outDir, err = build(auditpack.SymlinksFollow)
+	if err != nil {
+		t.Fatalf("build follow: %v", err)
+	}
+	m = manifest.Manifest{}
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	if len(m.Files) != 2 || m.Files[1].Type != manifest.TypeFile || m.Files[1].SHA256 != m.Files[0].SHA256 {
+		t.Fatalf("follow: unexpected entries %+v", m.Files)
+	}
+
+	// error: build refuses.
+	if _, err := build(auditpack.SymlinksError); err == nil || !strings.Contains(err.Error(), "link.txt") {
+		t.Fatalf("error policy: expected symlink error, got %v", err)
+	}
+}
+
+func TestBuild_SymlinkFollowRefusesEscape(t *testing.T) {
+	t.Parallel()
+
+	root, inDir := symlinkInput(t)
+	mustSymlink(t, filepath.Join(root, "outside.txt"), filepath.Join(inDir, "escape.txt"))
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Symlinks = auditpack.SymlinksFollow
+	err := auditpack.Build(inDir, t.TempDir(), opts)
+	if err == nil || !strings.Contains(err.Error(), "escapes input root") {
+		t.Fatalf("expected escape error, got %v", err)
+	}
+}
+
+func TestVerifyInput_RecordedSymlinkRetargeted(t *testing.T) {
+	t.Parallel()
+
+	_, inDir := symlinkInput(t)
+	mustWrite(t, filepath.Join(inDir, "b.txt"), []byte("alpha\n"))
+	outDir := t.TempDir()
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Symlinks = auditpack.SymlinksRecord
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	// Point the link at an identical file: content is the same, target is not.
+	if err := os.Remove(filepath.Join(inDir, "link.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	mustSymlink(t, "b.txt", filepath.Join(inDir, "link.txt"))
+
+	err := auditpack.VerifyInput(inDir, outDir, false)
+	if err == nil || !strings.Contains(err.Error(), "symlink target mismatch") {
+		t.Fatalf("expected target mismatch, got %v", err)
+	}
+
+	// Replacing the link with a regular file is also caught.
+	if err := os.Remove(filepath.Join(inDir, "link.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	mustWrite(t, filepath.Join(inDir, "link.txt"), []byte("a.txt"))
+	err = auditpack.VerifyInput(inDir, outDir, false)
+	if err == nil || !strings.Contains(err.Error(), "not a symlink") {
+		t.Fatalf("expected not-a-symlink failure, got %v", err)
+	}
+}
+
+func TestVerifyInput_RefusesPathsThroughSymlinks(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	inDir := filepath.Join(root, "in")
+	mustWrite(t, filepath.Join(inDir, "a.txt"), []byte("alpha\n"))
+	mustWrite(t, filepath.Join(inDir, "nested", "b.txt"), []byte("bravo\n"))
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	// An identical copy elsewhere, reached through a symlink, is not the file
+	// that was packed.
+	mustWrite(t, filepath.Join(root, "copy", "b.txt"), []byte("bravo\n"))
+	if err := os.Remove(filepath.Join(inDir, "nested", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	mustSymlink(t, filepath.Join(root, "copy", "b.txt"), filepath.Join(inDir, "nested", "b.txt"))
+	assertUnsafe(t, inDir, outDir, "nested/b.txt", "nested/b.txt")
+
+	// Same for a parent directory symlinked out of the tree.
+	if err := os.RemoveAll(filepath.Join(inDir, "nested")); err != nil {
+		t.Fatal(err)
+	}
+	mustSymlink(t, filepath.Join(root, "copy"), filepath.Join(inDir, "nested"))
+	assertUnsafe(t, inDir, outDir, "nested/b.txt", "nested")
+}
+
+func assertUnsafe(t *testing.T, inDir, outDir, path, at string) {
+	t.Helper()
+	rep, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, auditpack.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(rep.Problems) != 1 {
+		t.Fatalf("expected one problem, got %+v", rep.Problems)
+	}
+	pr := rep.Problems[0]
+	if pr.Kind != auditpack.ProblemUnsafePath || pr.Path != path || pr.Actual != at {
+		t.Fatalf("unexpected problem: %+v", pr)
+	}
+	if !strings.Contains(pr.Message, "crosses a symlink") {
+		t.Fatalf("unexpected message: %s", pr.Message)
+	}
+}
+
+func TestVerifyInput_FollowPackAcceptsFinalLink(t *testing.T) {
+	t.Parallel()
+
+	root, inDir := symlinkInput(t)
+	outDir := t.TempDir()
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Symlinks = auditpack.SymlinksFollow
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// Retargeting the link outside the root is refused even with identical content.
+	mustWrite(t, filepath.Join(root, "alpha.txt"), []byte("alpha\n"))
+	if err := os.Remove(filepath.Join(inDir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	mustSymlink(t, filepath.Join(root, "alpha.txt"), filepath.Join(inDir, "link.txt"))
+	err := auditpack.VerifyInput(inDir, outDir, true)
+	if err == nil || !strings.Contains(err.Error(), "resolves outside the input root") {
+		t.Fatalf("expected escape failure, got %v", err)
+	}
+}
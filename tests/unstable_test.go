@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/auditpack"
+	"github.com/nicholaskarlson/proof-first-auditpack/internal/manifest"
+)
+
+// growing returns a Progress callback that appends to path while it is being
+// hashed, on the first `times` reads (every read when times < 0).
+func growing(t *testing.T, path string, times int) auditpack.ProgressFunc {
+	t.Helper()
+	var mu sync.Mutex
+	seen := 0
+	return func(p auditpack.Progress) {
+		if p.BytesDone == 0 || p.Path != filepath.Base(path) {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if times >= 0 && seen >= times {
+			return
+		}
+		seen++
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Errorf("open: %v", err)
+			return
+		}
+		defer f.Close()
+		if _, err := f.Write([]byte("more\n")); err != nil {
+			t.Errorf("append: %v", err)
+		}
+	}
+}
+
+func unstableInput(t *testing.T) (inDir, big string) {
+	t.Helper()
+	inDir = filepath.Join(t.TempDir(), "in")
+	big = filepath.Join(inDir, "ledger.csv")
+	// Large enough for a progress report in the middle of the read.
+	mustWrite(t, big, bytes.Repeat([]byte("0123456789abcdef"), 3<<16))
+	mustWrite(t, filepath.Join(inDir, "small.txt"), []byte("small\n"))
+	return inDir, big
+}
+
+func TestBuild_RetriesFileChangedWhileHashed(t *testing.T) {
+	t.Parallel()
+	inDir, big := unstableInput(t)
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Jobs = 1
+	opts.Retry = auditpack.RetryPolicy{Retries: 1}
+	opts.Progress = growing(t, big, 1)
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	// The digest is of the file as it was after the change.
+	if err := auditpack.VerifyInput(inDir, outDir, true); err != nil {
+		t.Fatalf("verify after retried build: %v", err)
+	}
+}
+
+func TestBuild_FailsOrRecordsUnstableFile(t *testing.T) {
+	t.Parallel()
+	inDir, big := unstableInput(t)
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	opts.Jobs = 1
+	opts.Retry = auditpack.RetryPolicy{Retries: 2}
+	opts.Progress = growing(t, big, -1)
+	err := auditpack.Build(inDir, t.TempDir(), opts)
+	var u *auditpack.UnstableError
+	if !errors.Is(err, auditpack.ErrUnstable) || !errors.As(err, &u) || u.Path != "ledger.csv" || u.Field != "size" || u.Attempts != 3 {
+		t.Fatalf("expected an unstable error after 3 attempts, got %v", err)
+	}
+
+	opts.OnError = auditpack.ErrorsRecord
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build --on-error record: %v", err)
+	}
+	var m manifest.Manifest
+	if err := json.Unmarshal(mustRead(t, filepath.Join(outDir, "manifest.json")), &m); err != nil {
+		t.Fatalf("parse manifest.json: %v", err)
+	}
+	if len(m.Errors) != 1 || m.Errors[0].Path != "ledger.csv" || m.Errors[0].Class != auditpack.ErrClassUnstable {
+		t.Fatalf("unexpected errors section: %+v", m.Errors)
+	}
+}
+
+func TestVerifyInput_ReportsUnstableFile(t *testing.T) {
+	t.Parallel()
+	inDir, big := unstableInput(t)
+
+	opts := auditpack.DefaultOptions()
+	opts.InputLabel = "test/input"
+	outDir := t.TempDir()
+	if err := auditpack.Build(inDir, outDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	vopts := auditpack.VerifyOptions{Jobs: 1, Progress: growing(t, big, -1)}
+	rep, err := auditpack.VerifyInputReport(context.Background(), inDir, outDir, vopts)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(rep.Problems) != 1 || rep.Problems[0].Kind != auditpack.ProblemUnstable || rep.Problems[0].Field != "size" {
+		t.Fatalf("unexpected problems: %+v", rep.Problems)
+	}
+
+	// DefaultVerifyOptions retries: a file that changes once is read again
+	// and then reported for what it now holds, not as unstable.
+	vopts = auditpack.DefaultVerifyOptions()
+	vopts.Jobs = 1
+	vopts.Progress = growing(t, big, 1)
+	rep, err = auditpack.VerifyInputReport(context.Background(), inDir, outDir, vopts)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(rep.Problems) != 1 || rep.Problems[0].Kind == auditpack.ProblemUnstable {
+		t.Fatalf("expected the changed file to be re-read, got %+v", rep.Problems)
+	}
+}